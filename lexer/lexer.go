@@ -9,18 +9,191 @@ import (
 
 var eof = rune(0)
 
+// words maps keywords which cannot be scanned as identifiers, because they
+// start with a digit or contain symbols, to their tokens. They are matched
+// case-insensitively and must be delimited by whitespace.
+var words = map[string]Token{
+	"2OVER":       TwoOver,
+	"2NIP":        TwoNip,
+	"?DUP":        QDup,
+	"1+":          OnePlus,
+	"1-":          OneMinus,
+	"2+":          TwoPlus,
+	"2-":          TwoMinus,
+	"2*":          TwoMultiply,
+	"2/":          TwoDivide,
+	".S":          PrintStack,
+	"---":         Separator,
+	"DEFINED?":    Defined,
+	"[IF]":        CondIf,
+	"[THEN]":      CondThen,
+	"ROLL-ALL":    RollAll,
+	"EMPTY?":      Empty,
+	"CELL+":       CellPlus,
+	"COMPARE-MEM": CompareMem,
+	"U.":          UPrint,
+	">BUFFER":     ToBuffer,
+	"BUFFER>":     FromBuffer,
+	"#WORDS":      NumWords,
+	"#VARS":       NumVars,
+	"?EXECUTE":    QExecute,
+	"OVERFLOW?":   Overflowed,
+	">R":          ToR,
+	"R>":          FromR,
+	"R@":          RFetch,
+	"2>R":         TwoToR,
+	"2R>":         TwoFromR,
+	"2R@":         TwoRFetch,
+	"ABORT\"":     AbortQuote,
+	"BYTE@":       ByteGet,
+	"BYTE!":       ByteStore,
+	"/MOD":        DivMod,
+	"*/":          MulDiv,
+	"*/MOD":       MulDivMod,
+	"C@":          CFetch,
+	"C!":          CStore,
+}
+
+// maxWordLen is the maximum length of a key in words.
+const maxWordLen = 16
+
 type Scanner struct {
 	r *bufio.Reader
 
-	line int
-	col  int
+	// line and col are the zero-based position of the next rune, prevLine
+	// and prevCol the position before the last read, restored by unread.
+	line, col         int
+	prevLine, prevCol int
+
+	// pos is the position of the last scanned token.
+	pos Pos
+
+	// started is set once the first token has been scanned.
+	started bool
+
+	// peeked holds the token returned by Peek until it is consumed by Scan.
+	peeked    bool
+	peekedTok Token
+	peekedLit string
+
+	// caseSensitive makes only lowercase spellings match keywords.
+	caseSensitive bool
+
+	// lineComments makes "//" start a comment running to the end of the
+	// line.
+	lineComments bool
 }
 
-func NewScanner(r io.Reader) *Scanner {
-	return &Scanner{r: bufio.NewReader(r)}
+// Option configures a Scanner.
+type Option func(*Scanner)
+
+// CaseSensitiveKeywords sets whether keywords must be written in lowercase.
+// When enabled, other spellings such as DUP or Dup are scanned as
+// identifiers. By default keywords match regardless of case.
+func CaseSensitiveKeywords(enabled bool) Option {
+	return func(s *Scanner) {
+		s.caseSensitive = enabled
+	}
+}
+
+// LineComments sets whether "//" starts a comment running to the end of the
+// line, in addition to ( ) comments. It is disabled by default, which scans
+// "//" as two divisions.
+func LineComments(enabled bool) Option {
+	return func(s *Scanner) {
+		s.lineComments = enabled
+	}
+}
+
+func NewScanner(r io.Reader, opts ...Option) *Scanner {
+	s := &Scanner{r: bufio.NewReader(r)}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// keyword returns the key lit is looked up by among the keywords, and false
+// if lit cannot be a keyword.
+func (s *Scanner) keyword(lit string) (string, bool) {
+	if s.caseSensitive && lit != strings.ToLower(lit) {
+		return "", false
+	}
+
+	return strings.ToUpper(lit), true
 }
 
 func (s *Scanner) Scan() (Token, string) {
+	if s.peeked {
+		s.peeked = false
+		return s.peekedTok, s.peekedLit
+	}
+
+	return s.scan()
+}
+
+// Pos returns the position of the first rune of the last token returned by
+// Scan or Peek.
+func (s *Scanner) Pos() Pos {
+	return s.pos
+}
+
+// Peek returns the next token without consuming it. Repeated calls return the
+// same token until Scan is called.
+func (s *Scanner) Peek() (Token, string) {
+	if !s.peeked {
+		s.peekedTok, s.peekedLit = s.scan()
+		s.peeked = true
+	}
+
+	return s.peekedTok, s.peekedLit
+}
+
+// Lexeme is a scanned token together with its literal and position.
+type Lexeme struct {
+	Tok Token
+	Lit string
+	Pos Pos
+}
+
+// Tokens scans the rest of the input and returns all tokens before EOF.
+// Whitespace tokens are only included if ws is set.
+func (s *Scanner) Tokens(ws bool) []Lexeme {
+	var lexemes []Lexeme
+	for {
+		tok, lit := s.Scan()
+		if tok == EOF {
+			return lexemes
+		}
+
+		if tok != WS || ws {
+			lexemes = append(lexemes, Lexeme{Tok: tok, Lit: lit, Pos: s.Pos()})
+		}
+	}
+}
+
+// Tokenize returns all tokens in r, excluding whitespace.
+func Tokenize(r io.Reader) []Lexeme {
+	return NewScanner(r).Tokens(false)
+}
+
+func (s *Scanner) scan() (Token, string) {
+	if !s.started {
+		s.started = true
+		s.skipShebang()
+	}
+
+	s.pos = Pos{Line: s.line + 1, Col: s.col + 1}
+
+	if tok, lit, ok := s.scanWord(); ok {
+		if tok == AbortQuote {
+			return tok, lit + s.scanMessage()
+		}
+
+		return tok, lit
+	}
+
 	ch := s.read()
 
 	// consume all contigous whitespace
@@ -30,17 +203,12 @@ func (s *Scanner) Scan() (Token, string) {
 	}
 
 	if isDigit(ch) {
-		s.unread()
-		return s.scanNumber()
+		return s.scanNumber(ch)
 	}
 
 	if ch == '-' {
-		next := s.read()
-		s.unread()
-
-		if isDigit(next) {
-			s.unread()
-			return s.scanNumber()
+		if next, _ := s.r.Peek(1); len(next) == 1 && isDigit(rune(next[0])) {
+			return s.scanNumber(ch)
 		}
 
 		return Minus, string(ch)
@@ -56,6 +224,12 @@ func (s *Scanner) Scan() (Token, string) {
 		return s.scanComment()
 	}
 
+	if ch == '/' && s.lineComments {
+		if next, _ := s.r.Peek(1); len(next) == 1 && next[0] == '/' {
+			return s.scanLineComment(ch)
+		}
+	}
+
 	switch ch {
 	case eof:
 		return EOF, ""
@@ -73,6 +247,10 @@ func (s *Scanner) Scan() (Token, string) {
 		return Get, string(ch)
 	case '!':
 		return Store, string(ch)
+	case '.':
+		return Print, string(ch)
+	case '\'':
+		return Tick, string(ch)
 
 	case '<', '>', '=':
 		s.unread()
@@ -85,15 +263,78 @@ func (s *Scanner) Scan() (Token, string) {
 // read reads the next rune from the bufferred reader.
 // Returns the rune(0) if an error occurs (or io.EOF is returned).
 func (s *Scanner) read() rune {
+	s.prevLine, s.prevCol = s.line, s.col
+
 	ch, _, err := s.r.ReadRune()
 	if err != nil {
 		return eof
 	}
+
+	if ch == '\n' {
+		s.line++
+		s.col = 0
+	} else {
+		s.col++
+	}
 	return ch
 }
 
-// unread places the previously read rune back on the reader.
-func (s *Scanner) unread() { _ = s.r.UnreadRune() }
+// unread places the previously read rune back on the reader. Only the last
+// rune read can be unread, and not after peeking at s.r, so looking further
+// ahead must be done by peeking instead.
+func (s *Scanner) unread() {
+	_ = s.r.UnreadRune()
+	s.line, s.col = s.prevLine, s.prevCol
+}
+
+// skipShebang discards a "#!" interpreter line at the very start of the
+// input, so scripts can be made executable.
+func (s *Scanner) skipShebang() {
+	if b, _ := s.r.Peek(2); string(b) != "#!" {
+		return
+	}
+
+	for {
+		if ch := s.read(); ch == eof || ch == '\n' {
+			break
+		}
+	}
+}
+
+// scanWord consumes the upcoming whitespace delimited word if it is one of
+// words.
+func (s *Scanner) scanWord() (Token, string, bool) {
+	// Peek one byte at a time so no input past the word is waited for.
+	var n int
+	for n <= maxWordLen {
+		b, _ := s.r.Peek(n + 1)
+		if len(b) <= n || isWhitespace(rune(b[n])) {
+			break
+		}
+		n++
+	}
+
+	if n == 0 || n > maxWordLen {
+		return ILLEGAL, "", false
+	}
+
+	b, _ := s.r.Peek(n)
+	lit := string(b)
+
+	key, ok := s.keyword(lit)
+	if !ok {
+		return ILLEGAL, "", false
+	}
+
+	tok, ok := words[key]
+	if !ok {
+		return ILLEGAL, "", false
+	}
+
+	_, _ = s.r.Discard(n)
+	s.col += n
+	return tok, lit, true
+}
 
 // scanWhitespace consumes the current rune and all contiguous whitespace.
 func (s *Scanner) scanWhitespace() (Token, string) {
@@ -137,8 +378,13 @@ func (s *Scanner) scanIdent() (Token, string) {
 		}
 	}
 
+	key, ok := s.keyword(buf.String())
+	if !ok {
+		return Ident, buf.String()
+	}
+
 	// If the string matches a keyword then return that keyword.
-	switch strings.ToUpper(buf.String()) {
+	switch key {
 	case "VARIABLE":
 		return Variable, buf.String()
 	case "CELLS":
@@ -153,6 +399,24 @@ func (s *Scanner) scanIdent() (Token, string) {
 		return While, buf.String()
 	case "REPEAT":
 		return Repeat, buf.String()
+	case "EXECUTE":
+		return Execute, buf.String()
+	case "CASE":
+		return Case, buf.String()
+	case "OF":
+		return Of, buf.String()
+	case "ENDOF":
+		return EndOf, buf.String()
+	case "ENDCASE":
+		return EndCase, buf.String()
+	case "LEAVE":
+		return Leave, buf.String()
+	case "ALIAS":
+		return Alias, buf.String()
+	case "TIME":
+		return Time, buf.String()
+	case "ENDTIME":
+		return EndTime, buf.String()
 	case "QUIT":
 		return Quit, buf.String()
 	case "MOD":
@@ -163,20 +427,116 @@ func (s *Scanner) scanIdent() (Token, string) {
 		return Dup, buf.String()
 	case "SWAP":
 		return Swap, buf.String()
+	case "HEX":
+		return Hex, buf.String()
+	case "DECIMAL":
+		return Decimal, buf.String()
+	case "FILL":
+		return Fill, buf.String()
+	case "MOVE":
+		return Move, buf.String()
+	case "SIZE":
+		return Size, buf.String()
+	case "DUMP":
+		return Dump, buf.String()
+	case "MAXINT":
+		return MaxInt, buf.String()
+	case "MININT":
+		return MinInt, buf.String()
+	case "MARK":
+		return Mark, buf.String()
+	case "ARITY":
+		return Arity, buf.String()
+	case "BOOL":
+		return Bool, buf.String()
+	case "FLAG":
+		return Flag, buf.String()
+	case "SQRT":
+		return Sqrt, buf.String()
+	case "GCD":
+		return Gcd, buf.String()
+	case "LCM":
+		return Lcm, buf.String()
+	case "READ":
+		return Read, buf.String()
+	case "MODPOW":
+		return ModPow, buf.String()
+	case "RANDOM":
+		return Random, buf.String()
+	case "HASH":
+		return Hash, buf.String()
+	case "THIRD":
+		return Third, buf.String()
+	case "FOURTH":
+		return Fourth, buf.String()
+	case "NOT":
+		return Not, buf.String()
+	case "WORDS":
+		return Words, buf.String()
+	case "FACTORIAL":
+		return Factorial, buf.String()
+	case "ERASE":
+		return Erase, buf.String()
+	case "RDEPTH":
+		return RDepth, buf.String()
+	case "SORT":
+		return Sort, buf.String()
+	case "FIND":
+		return Find, buf.String()
+	case "ENUM":
+		return Enum, buf.String()
+	case "GETCH":
+		return Getch, buf.String()
+	case "TYPE":
+		return Type, buf.String()
+	case "RETURNS":
+		return Returns, buf.String()
+	case "SEE":
+		return See, buf.String()
+	case "VALUE":
+		return Value, buf.String()
+	case "TO":
+		return To, buf.String()
+	case "EXIT":
+		return Exit, buf.String()
+	case "WITHIN":
+		return Within, buf.String()
+	case "REVERSE":
+		return Reverse, buf.String()
+	case "ALLOT":
+		return Allot, buf.String()
+	case "HERE":
+		return Here, buf.String()
 	}
 
 	// Otherwise return as a regular identifier.
 	return Ident, buf.String()
 }
 
-// scanNumber consumes the current rune and all contiguous number runes.
-func (s *Scanner) scanNumber() (Token, string) {
-	// Create a buffer and read the current character into it.
+// scanNumber consumes all contiguous number runes following first, the
+// already read digit or sign starting the number.
+func (s *Scanner) scanNumber(first rune) (Token, string) {
 	var buf bytes.Buffer
-	_, _ = buf.WriteRune(s.read())
+	_, _ = buf.WriteRune(first)
 
 	// Read every subsequent ident character into the buffer.
 	// Non-ident characters and EOF will cause the loop to exit.
+	s.scanDigits(&buf)
+
+	// A decimal point followed by a digit makes this a float.
+	if next, _ := s.r.Peek(2); len(next) == 2 && next[0] == '.' && isDigit(rune(next[1])) {
+		_, _ = buf.WriteRune(s.read())
+		s.scanDigits(&buf)
+
+		return Float, buf.String()
+	}
+
+	// Otherwise return as a regular identifier.
+	return Number, buf.String()
+}
+
+// scanDigits consumes all contiguous digits into buf.
+func (s *Scanner) scanDigits(buf *bytes.Buffer) {
 	for {
 		if ch := s.read(); ch == eof {
 			break
@@ -187,9 +547,6 @@ func (s *Scanner) scanNumber() (Token, string) {
 			_, _ = buf.WriteRune(ch)
 		}
 	}
-
-	// Otherwise return as a regular identifier.
-	return Number, buf.String()
 }
 
 // scanComparator consumes the current rune and all contiguous comparator runes.
@@ -204,6 +561,11 @@ func (s *Scanner) scanComparator() (Token, string) {
 	}
 
 	next := s.read()
+	if ch == '<' && next == '>' {
+		_, _ = buf.WriteRune(next)
+		return NE, buf.String()
+	}
+
 	if next != '=' {
 		s.unread()
 
@@ -227,6 +589,26 @@ func (s *Scanner) scanComparator() (Token, string) {
 	return ILLEGAL, buf.String()
 }
 
+// scanMessage consumes the runes up to and including the next '"', or up
+// to the end of the input if there is none.
+func (s *Scanner) scanMessage() string {
+	var buf bytes.Buffer
+	for {
+		ch := s.read()
+		if ch == eof {
+			break
+		}
+
+		buf.WriteRune(ch)
+
+		if ch == '"' {
+			break
+		}
+	}
+
+	return buf.String()
+}
+
 // scanComment consumes the current rune and all contiguous comment runes.
 func (s *Scanner) scanComment() (Token, string) {
 	// Create a buffer and read the current character into it.
@@ -253,3 +635,26 @@ func (s *Scanner) scanComment() (Token, string) {
 	// Otherwise return as a regular identifier.
 	return Comment, buf.String()
 }
+
+// scanLineComment consumes all runes following first up to the end of the
+// line, leaving the newline to be scanned as whitespace.
+func (s *Scanner) scanLineComment(first rune) (Token, string) {
+	var buf bytes.Buffer
+	_, _ = buf.WriteRune(first)
+
+	for {
+		ch := s.read()
+		if ch == eof {
+			break
+		}
+
+		if ch == '\n' {
+			s.unread()
+			break
+		}
+
+		buf.WriteRune(ch)
+	}
+
+	return Comment, buf.String()
+}
@@ -0,0 +1,242 @@
+package lexer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPeek(t *testing.T) {
+	s := NewScanner(strings.NewReader("dup 5"))
+
+	for i := 0; i < 2; i++ {
+		tok, lit := s.Peek()
+		if tok != Dup || lit != "dup" {
+			t.Fatalf("Peek %d: got %v %q, want Dup \"dup\"", i, tok, lit)
+		}
+	}
+
+	if tok, _ := s.Scan(); tok != Dup {
+		t.Fatalf("Scan after Peek: got %v, want Dup", tok)
+	}
+
+	if tok, _ := s.Scan(); tok != WS {
+		t.Fatalf("got %v, want WS", tok)
+	}
+
+	if tok, lit := s.Peek(); tok != Number || lit != "5" {
+		t.Fatalf("got %v %q, want Number \"5\"", tok, lit)
+	}
+
+	if tok, lit := s.Scan(); tok != Number || lit != "5" {
+		t.Fatalf("got %v %q, want Number \"5\"", tok, lit)
+	}
+
+	if tok, _ := s.Peek(); tok != EOF {
+		t.Fatalf("got %v, want EOF", tok)
+	}
+}
+
+func TestShebang(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []Token
+	}{
+		{"#!/usr/bin/env techon\n5 dup", []Token{Number, Dup}},
+		{"#!techon", nil},
+		{"5 #!", []Token{Number, ILLEGAL, Store}},
+	}
+
+	for _, tt := range tests {
+		var got []Token
+		for _, l := range Tokenize(strings.NewReader(tt.src)) {
+			got = append(got, l.Tok)
+		}
+
+		if !equalTokens(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestShebangPosition(t *testing.T) {
+	lexemes := Tokenize(strings.NewReader("#!/bin/techon\n  dup"))
+	if len(lexemes) != 1 {
+		t.Fatalf("got %d tokens, want 1", len(lexemes))
+	}
+
+	if pos := lexemes[0].Pos; pos.Line != 2 || pos.Col != 3 {
+		t.Errorf("got %s, want line 2, col 3", pos)
+	}
+}
+
+func equalTokens(a, b []Token) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestPos(t *testing.T) {
+	lexemes := Tokenize(strings.NewReader("1 2\n  dup\n\nswap"))
+	want := []Pos{{1, 1}, {1, 3}, {2, 3}, {4, 1}}
+
+	if len(lexemes) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(lexemes), len(want))
+	}
+
+	for i, l := range lexemes {
+		if l.Pos != want[i] {
+			t.Errorf("token %d %q: got %s, want %s", i, l.Lit, l.Pos, want[i])
+		}
+	}
+}
+
+func TestFloat(t *testing.T) {
+	tests := []struct {
+		src string
+		tok Token
+	}{
+		{"1.5", Float},
+		{"-0.25", Float},
+		{"15", Number},
+	}
+
+	for _, tt := range tests {
+		tok, lit := NewScanner(strings.NewReader(tt.src)).Scan()
+		if tok != tt.tok || lit != tt.src {
+			t.Errorf("%q: got %v %q, want %v", tt.src, tok, lit, tt.tok)
+		}
+	}
+}
+
+func TestTokens(t *testing.T) {
+	s := NewScanner(strings.NewReader("1 dup\n+"))
+	lexemes := s.Tokens(true)
+
+	want := []Lexeme{
+		{Number, "1", Pos{1, 1}},
+		{WS, " ", Pos{1, 2}},
+		{Dup, "dup", Pos{1, 3}},
+		{WS, "\n", Pos{1, 6}},
+		{Plus, "+", Pos{2, 1}},
+	}
+
+	if len(lexemes) != len(want) {
+		t.Fatalf("got %v, want %v", lexemes, want)
+	}
+
+	for i := range want {
+		if lexemes[i] != want[i] {
+			t.Errorf("token %d: got %v, want %v", i, lexemes[i], want[i])
+		}
+	}
+
+	if got := Tokenize(strings.NewReader("1 dup\n+")); len(got) != 3 {
+		t.Errorf("Tokenize returned %d tokens, want 3", len(got))
+	}
+}
+
+func TestComparators(t *testing.T) {
+	tests := map[string]Token{
+		"=":  EQ,
+		"<>": NE,
+		"<":  LT,
+		">":  GT,
+		"<=": LTE,
+		">=": GTE,
+	}
+
+	for src, want := range tests {
+		if tok, _ := NewScanner(strings.NewReader(src)).Scan(); tok != want {
+			t.Errorf("%q: got %v, want %v", src, tok, want)
+		}
+	}
+}
+
+func TestCaseSensitiveKeywords(t *testing.T) {
+	tests := []struct {
+		src       string
+		sensitive bool
+		want      Token
+	}{
+		{"dup", false, Dup},
+		{"DUP", false, Dup},
+		{"Dup", false, Dup},
+		{"dup", true, Dup},
+		{"DUP", true, Ident},
+		{"Dup", true, Ident},
+		{"VARIABLE", true, Ident},
+	}
+
+	for _, tt := range tests {
+		s := NewScanner(strings.NewReader(tt.src), CaseSensitiveKeywords(tt.sensitive))
+		if tok, lit := s.Scan(); tok != tt.want || lit != tt.src {
+			t.Errorf("%q (sensitive %v): got %v %q, want %v", tt.src, tt.sensitive, tok, lit, tt.want)
+		}
+	}
+}
+
+func TestMinus(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []Lexeme
+	}{
+		{"-5", []Lexeme{{Number, "-5", Pos{1, 1}}}},
+		{"- 5", []Lexeme{{Minus, "-", Pos{1, 1}}, {Number, "5", Pos{1, 3}}}},
+		{"3 -", []Lexeme{{Number, "3", Pos{1, 1}}, {Minus, "-", Pos{1, 3}}}},
+		{"-", []Lexeme{{Minus, "-", Pos{1, 1}}}},
+		{"-x", []Lexeme{{Minus, "-", Pos{1, 1}}, {Ident, "x", Pos{1, 2}}}},
+		{"--1", []Lexeme{{Minus, "-", Pos{1, 1}}, {Number, "-1", Pos{1, 2}}}},
+		{"-1.5 -2", []Lexeme{{Float, "-1.5", Pos{1, 1}}, {Number, "-2", Pos{1, 6}}}},
+	}
+
+	for _, tt := range tests {
+		got := Tokenize(strings.NewReader(tt.src))
+		if len(got) != len(tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.src, got, tt.want)
+			continue
+		}
+
+		for i := range tt.want {
+			if got[i] != tt.want[i] {
+				t.Errorf("%q: token %d: got %v, want %v", tt.src, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestLineComments(t *testing.T) {
+	tests := []struct {
+		src     string
+		enabled bool
+		want    []Token
+	}{
+		{"3 4 + // add", true, []Token{Number, Number, Plus, Comment}},
+		{"3 4 + // add\ndup", true, []Token{Number, Number, Plus, Comment, Dup}},
+		{"6 2 / 1", true, []Token{Number, Number, Divide, Number}},
+		{"3 4 + // add", false, []Token{Number, Number, Plus, Divide, Divide, Ident}},
+	}
+
+	for _, tt := range tests {
+		var got []Token
+		for _, lex := range NewScanner(strings.NewReader(tt.src), LineComments(tt.enabled)).Tokens(false) {
+			got = append(got, lex.Tok)
+		}
+
+		if !equalTokens(got, tt.want) {
+			t.Errorf("%q (enabled %v): got %v, want %v", tt.src, tt.enabled, got, tt.want)
+		}
+	}
+
+	lexemes := NewScanner(strings.NewReader("1 // one\n"), LineComments(true)).Tokens(false)
+	if len(lexemes) != 2 || lexemes[1].Lit != "// one" {
+		t.Errorf("got %v, want the comment without its newline", lexemes)
+	}
+}
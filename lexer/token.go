@@ -1,5 +1,7 @@
 package lexer
 
+import "fmt"
+
 type Token int
 
 const (
@@ -10,6 +12,7 @@ const (
 	Variable
 	Ident
 	Number
+	Float
 	Cells
 
 	Minus
@@ -18,7 +21,15 @@ const (
 	Divide
 	Modulus
 
+	OnePlus
+	OneMinus
+	TwoPlus
+	TwoMinus
+	TwoMultiply
+	TwoDivide
+
 	EQ
+	NE
 	LT
 	GT
 	LTE
@@ -26,21 +37,107 @@ const (
 
 	Drop
 	Dup
+	QDup
 	Swap
+	TwoOver
+	TwoNip
+	Dump
+	MaxInt
+	MinInt
+	Separator
+	Mark
+	Arity
+	Bool
+	Flag
+	Defined
+	Sqrt
+	Gcd
+	Lcm
+	RollAll
+	Empty
+	CellPlus
+	Read
+	ModPow
+	Random
+	Hash
+	Time
+	EndTime
+	Third
+	Fourth
+	Not
+	Words
+	Factorial
+	Alias
+	Erase
+	CondIf
+	CondThen
+	CompareMem
+	UPrint
+	RDepth
+	ToBuffer
+	FromBuffer
+	Sort
+	Find
+	NumWords
+	NumVars
+	QExecute
+	Overflowed
+	Enum
+	Getch
+	Type
+	ToR
+	FromR
+	RFetch
+	TwoToR
+	TwoFromR
+	TwoRFetch
+	Returns
+	See
+	AbortQuote
+	Value
+	To
+	ByteGet
+	ByteStore
+	Exit
+	Within
+	DivMod
+	MulDiv
+	MulDivMod
+	Reverse
+	Allot
+	Here
+	CFetch
+	CStore
 	Comment
 
 	Get
 	Store
+	Fill
+	Move
+	Size
+
+	Print
+	PrintStack
+	Hex
+	Decimal
 
 	If
 	Else
 	Then
 	While
 	Repeat
+	Leave
+	Case
+	Of
+	EndOf
+	EndCase
 
 	StartFunc
 	EndFunc
 
+	Tick
+	Execute
+
 	Quit
 )
 
@@ -59,6 +156,8 @@ func (t Token) String() string {
 		return "Ident"
 	case Number:
 		return "Number"
+	case Float:
+		return "Float"
 	case Cells:
 		return "Cells"
 	case Minus:
@@ -71,8 +170,22 @@ func (t Token) String() string {
 		return "Divide"
 	case Modulus:
 		return "Modulus"
+	case OnePlus:
+		return "OnePlus"
+	case OneMinus:
+		return "OneMinus"
+	case TwoPlus:
+		return "TwoPlus"
+	case TwoMinus:
+		return "TwoMinus"
+	case TwoMultiply:
+		return "TwoMultiply"
+	case TwoDivide:
+		return "TwoDivide"
 	case EQ:
 		return "EQ"
+	case NE:
+		return "NE"
 	case LT:
 		return "LT"
 	case GT:
@@ -87,12 +200,166 @@ func (t Token) String() string {
 		return "Dup"
 	case Swap:
 		return "Swap"
+	case TwoOver:
+		return "TwoOver"
+	case TwoNip:
+		return "TwoNip"
+	case QDup:
+		return "QDup"
+	case PrintStack:
+		return "PrintStack"
+	case Fill:
+		return "Fill"
+	case Move:
+		return "Move"
+	case Size:
+		return "Size"
+	case Dump:
+		return "Dump"
+	case MaxInt:
+		return "MaxInt"
+	case MinInt:
+		return "MinInt"
+	case Separator:
+		return "Separator"
+	case Mark:
+		return "Mark"
+	case Arity:
+		return "Arity"
+	case Bool:
+		return "Bool"
+	case Flag:
+		return "Flag"
+	case Defined:
+		return "Defined"
+	case Sqrt:
+		return "Sqrt"
+	case Gcd:
+		return "Gcd"
+	case Lcm:
+		return "Lcm"
+	case RollAll:
+		return "RollAll"
+	case Empty:
+		return "Empty"
+	case CellPlus:
+		return "CellPlus"
+	case Read:
+		return "Read"
+	case ModPow:
+		return "ModPow"
+	case Random:
+		return "Random"
+	case Hash:
+		return "Hash"
+	case Time:
+		return "Time"
+	case EndTime:
+		return "EndTime"
+	case Third:
+		return "Third"
+	case Fourth:
+		return "Fourth"
+	case Not:
+		return "Not"
+	case Words:
+		return "Words"
+	case Factorial:
+		return "Factorial"
+	case Alias:
+		return "Alias"
+	case Erase:
+		return "Erase"
+	case CondIf:
+		return "CondIf"
+	case CondThen:
+		return "CondThen"
+	case CompareMem:
+		return "CompareMem"
+	case UPrint:
+		return "UPrint"
+	case RDepth:
+		return "RDepth"
+	case ToBuffer:
+		return "ToBuffer"
+	case FromBuffer:
+		return "FromBuffer"
+	case Sort:
+		return "Sort"
+	case Find:
+		return "Find"
+	case NumWords:
+		return "NumWords"
+	case NumVars:
+		return "NumVars"
+	case QExecute:
+		return "QExecute"
+	case Overflowed:
+		return "Overflowed"
+	case Enum:
+		return "Enum"
+	case Getch:
+		return "Getch"
+	case Type:
+		return "Type"
+	case ToR:
+		return "ToR"
+	case FromR:
+		return "FromR"
+	case RFetch:
+		return "RFetch"
+	case TwoToR:
+		return "TwoToR"
+	case TwoFromR:
+		return "TwoFromR"
+	case TwoRFetch:
+		return "TwoRFetch"
+	case Returns:
+		return "Returns"
+	case See:
+		return "See"
+	case AbortQuote:
+		return "AbortQuote"
+	case Value:
+		return "Value"
+	case To:
+		return "To"
+	case ByteGet:
+		return "ByteGet"
+	case ByteStore:
+		return "ByteStore"
+	case Exit:
+		return "Exit"
+	case Within:
+		return "Within"
+	case DivMod:
+		return "DivMod"
+	case MulDiv:
+		return "MulDiv"
+	case MulDivMod:
+		return "MulDivMod"
+	case Reverse:
+		return "Reverse"
+	case Allot:
+		return "Allot"
+	case Here:
+		return "Here"
+	case CFetch:
+		return "CFetch"
+	case CStore:
+		return "CStore"
 	case Comment:
 		return "Comment"
 	case Get:
 		return "Get"
 	case Store:
 		return "Store"
+	case Print:
+		return "Print"
+	case Hex:
+		return "Hex"
+	case Decimal:
+		return "Decimal"
 	case If:
 		return "If"
 	case Else:
@@ -103,13 +370,37 @@ func (t Token) String() string {
 		return "While"
 	case Repeat:
 		return "Repeat"
+	case Leave:
+		return "Leave"
+	case Case:
+		return "Case"
+	case Of:
+		return "Of"
+	case EndOf:
+		return "EndOf"
+	case EndCase:
+		return "EndCase"
 	case StartFunc:
 		return "StartFunc"
 	case EndFunc:
 		return "EndFunc"
+	case Tick:
+		return "Tick"
+	case Execute:
+		return "Execute"
 	case Quit:
 		return "Quit"
 	}
 
 	return "Unknown"
 }
+
+// Pos is a position in the scanned input. Lines and columns start at 1.
+type Pos struct {
+	Line int
+	Col  int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("line %d, col %d", p.Line, p.Col)
+}
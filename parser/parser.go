@@ -2,8 +2,10 @@ package parser
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"strconv"
+	"strings"
 
 	"github.com/noonien/techon/lexer"
 )
@@ -11,16 +13,38 @@ import (
 type lex struct {
 	tok lexer.Token
 	lit string
+	pos lexer.Pos
 }
 
 type Parser struct {
 	s              *lexer.Scanner
 	buf            []lex
 	actual, latest int
+
+	// prev is the last top-level statement parsed.
+	prev Statement
+
+	// defined holds the names of the variables, functions and aliases
+	// parsed so far, for [if].
+	defined map[string]bool
+
+	// conds is the number of [if] blocks being included whose [then] has
+	// not been reached yet.
+	conds int
+
+	// condErr is the error for a malformed [if], reported in place of the
+	// error for the ILLEGAL token read returns for it.
+	condErr error
 }
 
-func NewParser(r io.Reader) *Parser {
-	return &Parser{s: lexer.NewScanner(r), buf: make([]lex, 100)}
+// NewParser returns a Parser reading from r. The options configure the
+// underlying lexer.Scanner.
+func NewParser(r io.Reader, opts ...lexer.Option) *Parser {
+	return &Parser{
+		s:       lexer.NewScanner(r, opts...),
+		buf:     make([]lex, 100),
+		defined: make(map[string]bool),
+	}
 }
 
 // scan returns the next token from the underlying scanner.
@@ -32,17 +56,73 @@ func (p *Parser) scan() (lexer.Token, string) {
 		return lex.tok, lex.lit
 	}
 
-	tok, lit := p.s.Scan()
-	for tok == lexer.WS {
-		tok, lit = p.s.Scan()
-	}
+	tok, lit := p.read()
 
-	p.buf[p.actual] = lex{tok, lit}
+	p.buf[p.actual] = lex{tok, lit, p.s.Pos()}
 	p.latest = (p.latest + 1) % len(p.buf)
 	p.actual = p.latest
 	return tok, lit
 }
 
+// read returns the next token from the scanner, skipping whitespace and
+// applying [if] name ... [then] blocks, whose tokens are only kept if name
+// has been defined earlier in the input.
+func (p *Parser) read() (lexer.Token, string) {
+	for {
+		tok, lit := p.s.Scan()
+		switch tok {
+		case lexer.WS:
+			continue
+
+		case lexer.CondIf:
+			ntok, name := p.s.Scan()
+			for ntok == lexer.WS {
+				ntok, name = p.s.Scan()
+			}
+			if ntok != lexer.Ident {
+				p.condErr = fmt.Errorf("expected a name after [if] at %s", p.s.Pos())
+				return lexer.ILLEGAL, lit
+			}
+
+			if p.defined[name] {
+				p.conds++
+			} else {
+				p.skipCond()
+			}
+			continue
+
+		case lexer.CondThen:
+			if p.conds > 0 {
+				p.conds--
+				continue
+			}
+		}
+
+		return tok, lit
+	}
+}
+
+// skipCond discards tokens up to the [then] matching an [if] whose block
+// is excluded.
+func (p *Parser) skipCond() {
+	depth := 1
+	for depth > 0 {
+		switch tok, _ := p.s.Scan(); tok {
+		case lexer.EOF:
+			return
+		case lexer.CondIf:
+			depth++
+		case lexer.CondThen:
+			depth--
+		}
+	}
+}
+
+// pos returns the position of the token last returned by scan.
+func (p *Parser) pos() lexer.Pos {
+	return p.buf[(p.actual+len(p.buf)-1)%len(p.buf)].pos
+}
+
 // unscan pushes the previously read token back onto the buffer.
 func (p *Parser) unscan() {
 	p.actual--
@@ -52,47 +132,187 @@ func (p *Parser) unscan() {
 }
 
 func (p *Parser) Parse() (Program, error) {
-	return p.parseProgram()
-}
+	prog, err := p.parseProgram()
+	if err != nil {
+		return nil, err
+	}
 
-func (p *Parser) parseProgram() (Program, error) {
-	var prog Program
+	if tok, lit := p.scan(); tok != lexer.EOF {
+		return nil, p.invalid(tok, lit)
+	}
 
+	return prog, nil
+}
+
+// ParseAll parses a sequence of independent programs separated by ---.
+func (p *Parser) ParseAll() ([]Program, error) {
+	var progs []Program
 	for {
-		st, err := p.parseCommon()
+		prog, err := p.parseProgram()
 		if err != nil {
 			return nil, err
 		}
-		if st != nil {
-			prog = append(prog, st)
+		progs = append(progs, prog)
+
+		if tok, _ := p.scan(); tok == lexer.EOF {
+			return progs, nil
+		}
+		p.prev = nil
+	}
+}
+
+// ParseRecover parses the program read from r, continuing after errors. When
+// a statement cannot be parsed, the rest of its line is skipped, stopping
+// early at a function or variable declaration. It returns the statements
+// that could be parsed and every error encountered.
+func ParseRecover(r io.Reader) (Program, []error) {
+	p := NewParser(r)
+
+	var prog Program
+	var errs []error
+	for {
+		st, err := p.Next()
+		if err == io.EOF {
+			return prog, errs
+		}
+		if err != nil {
+			errs = append(errs, err)
+			p.skipLine()
 			continue
 		}
 
+		prog = append(prog, st)
+	}
+}
+
+// skipLine discards tokens up to the end of the line of the last scanned
+// token, or up to the next declaration.
+func (p *Parser) skipLine() {
+	line := p.pos().Line
+	for {
 		tok, _ := p.scan()
-		switch tok {
-		case lexer.EOF:
+		switch {
+		case tok == lexer.EOF, tok == lexer.StartFunc, tok == lexer.Variable, p.pos().Line > line:
+			p.unscan()
+			return
+		}
+	}
+}
+
+// invalid returns the error for an unexpected token, pointing at the
+// offending character if the token could not be scanned.
+func (p *Parser) invalid(tok lexer.Token, lit string) error {
+	if err := p.takeCondErr(); err != nil {
+		return err
+	}
+
+	if tok == lexer.ILLEGAL {
+		return fmt.Errorf("unexpected character '%s' at %s", lit, p.pos())
+	}
+
+	return errors.New("found invalid token: " + tok.String())
+}
+
+// takeCondErr returns and clears the error recorded for a malformed [if].
+func (p *Parser) takeCondErr() error {
+	err := p.condErr
+	p.condErr = nil
+	return err
+}
+
+// Next parses the next top-level statement, returning io.EOF once the input
+// is exhausted. Functions, ifs, loops and cases are returned as a single
+// statement.
+func (p *Parser) Next() (Statement, error) {
+	st, err := p.next()
+	if err != nil || st != nil {
+		return st, err
+	}
+
+	tok, lit := p.scan()
+	if tok == lexer.EOF {
+		return nil, io.EOF
+	}
+
+	return nil, p.invalid(tok, lit)
+}
+
+// parseProgram parses statements up to the end of the input or a separator,
+// which is left unread.
+func (p *Parser) parseProgram() (Program, error) {
+	var prog Program
+
+	for {
+		st, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		if st == nil {
 			return prog, nil
+		}
 
-		case lexer.Variable:
-			p.unscan()
-			st, err := p.parseVariableDeclaration()
-			if err != nil {
-				return nil, err
-			}
-			prog = append(prog, st)
+		prog = append(prog, st)
+	}
+}
 
-		case lexer.StartFunc:
-			p.unscan()
-			st, err := p.parseFunc()
-			if err != nil {
-				return nil, err
-			}
-			prog = append(prog, st)
+// next parses a top-level statement. At the end of the input or a separator
+// it returns nil, leaving the token unread.
+func (p *Parser) next() (Statement, error) {
+	st, err := p.parseTopLevel()
+	if err != nil {
+		if condErr := p.takeCondErr(); condErr != nil {
+			return nil, condErr
+		}
+		return nil, err
+	}
 
-		default:
-			return nil, errors.New("found invalid token: " + tok.String())
+	p.prev = st
+	return st, nil
+}
+
+func (p *Parser) parseTopLevel() (Statement, error) {
+	// enum and value define their names once, so they are not allowed in
+	// bodies, which can run many times
+	tok, _ := p.scan()
+	p.unscan()
+	switch tok {
+	case lexer.Enum:
+		return p.parseEnum()
+	case lexer.Value:
+		return p.parseValue()
+	}
+
+	st, err := p.parseCommon()
+	if err != nil || st != nil {
+		return st, err
+	}
+
+	tok, lit := p.scan()
+	switch tok {
+	case lexer.EOF, lexer.Separator:
+		p.unscan()
+		return nil, nil
+
+	case lexer.Variable:
+		p.unscan()
+		return p.parseVariableDeclaration()
+
+	case lexer.StartFunc:
+		p.unscan()
+		st, err := p.parseFunc()
+		if err != nil {
+			return nil, err
 		}
+
+		// a comment right before a function documents it
+		if c, ok := p.prev.(*Comment); ok {
+			st.Doc = strings.TrimSpace(c.Body)
+		}
+
+		return st, nil
 	}
+
+	return nil, p.invalid(tok, lit)
 }
 
 func (p *Parser) parseCommon() (Statement, error) {
@@ -102,6 +322,10 @@ func (p *Parser) parseCommon() (Statement, error) {
 		p.unscan()
 		return p.parsePushNumber()
 
+	case lexer.Float:
+		p.unscan()
+		return p.parsePushFloat()
+
 	case lexer.Ident:
 		p.unscan()
 		return p.parseIdentifierCall()
@@ -110,7 +334,11 @@ func (p *Parser) parseCommon() (Statement, error) {
 		p.unscan()
 		return p.parseMathOperation()
 
-	case lexer.EQ, lexer.LT, lexer.GT, lexer.LTE, lexer.GTE:
+	case lexer.OnePlus, lexer.OneMinus, lexer.TwoPlus, lexer.TwoMinus, lexer.TwoMultiply, lexer.TwoDivide:
+		p.unscan()
+		return p.parseUnaryOperation()
+
+	case lexer.EQ, lexer.NE, lexer.LT, lexer.GT, lexer.LTE, lexer.GTE:
 		p.unscan()
 		return p.parseCompareOperation()
 
@@ -123,7 +351,17 @@ func (p *Parser) parseCommon() (Statement, error) {
 	case lexer.Swap:
 		return &SwapStatement{}, nil
 
+	case lexer.TwoOver:
+		return &TwoOverStatement{}, nil
+
+	case lexer.TwoNip:
+		return &TwoNipStatement{}, nil
+
 	case lexer.Comment:
+		if strings.HasPrefix(lit, "//") {
+			return &Comment{Body: lit[2:]}, nil
+		}
+
 		return &Comment{Body: string(lit[1 : len(lit)-1])}, nil
 
 	case lexer.Get:
@@ -132,6 +370,15 @@ func (p *Parser) parseCommon() (Statement, error) {
 	case lexer.Store:
 		return &StoreStatement{}, nil
 
+	case lexer.Print:
+		return &PrintStatement{}, nil
+
+	case lexer.Hex:
+		return &HexStatement{}, nil
+
+	case lexer.Decimal:
+		return &DecimalStatement{}, nil
+
 	case lexer.If:
 		p.unscan()
 		return p.parseIfStatement()
@@ -140,6 +387,233 @@ func (p *Parser) parseCommon() (Statement, error) {
 		p.unscan()
 		return p.parseWhileStatement()
 
+	case lexer.Time:
+		p.unscan()
+		return p.parseTimeStatement()
+
+	case lexer.QDup:
+		return &QDupStatement{}, nil
+
+	case lexer.Case:
+		p.unscan()
+		return p.parseCaseStatement()
+
+	case lexer.Tick:
+		p.unscan()
+		return p.parseTick()
+
+	case lexer.Defined:
+		p.unscan()
+		return p.parseDefined()
+
+	case lexer.Alias:
+		p.unscan()
+		return p.parseAlias()
+
+	case lexer.Execute:
+		return &ExecuteStatement{}, nil
+
+	case lexer.Leave:
+		return &LeaveStatement{}, nil
+
+	case lexer.PrintStack:
+		return &PrintStackStatement{}, nil
+
+	case lexer.Fill:
+		return &FillStatement{}, nil
+
+	case lexer.Move:
+		return &MoveStatement{}, nil
+
+	case lexer.Size:
+		return &SizeStatement{}, nil
+
+	case lexer.Dump:
+		return &DumpStatement{}, nil
+
+	case lexer.MaxInt:
+		return &MaxIntStatement{}, nil
+
+	case lexer.MinInt:
+		return &MinIntStatement{}, nil
+
+	case lexer.Mark:
+		return &MarkStatement{}, nil
+
+	case lexer.Arity:
+		return &ArityStatement{}, nil
+
+	case lexer.Bool:
+		return &BoolStatement{}, nil
+
+	case lexer.Flag:
+		return &FlagStatement{}, nil
+
+	case lexer.Sqrt:
+		return &SqrtStatement{}, nil
+
+	case lexer.Gcd:
+		return &GcdStatement{}, nil
+
+	case lexer.Lcm:
+		return &LcmStatement{}, nil
+
+	case lexer.RollAll:
+		return &RollAllStatement{}, nil
+
+	case lexer.Empty:
+		return &EmptyStatement{}, nil
+
+	case lexer.CellPlus:
+		return &CellPlusStatement{}, nil
+
+	case lexer.Read:
+		return &ReadStatement{}, nil
+
+	case lexer.ModPow:
+		return &ModPowStatement{}, nil
+
+	case lexer.Random:
+		return &RandomStatement{}, nil
+
+	case lexer.Hash:
+		return &HashStatement{}, nil
+
+	case lexer.Third:
+		return &ThirdStatement{}, nil
+
+	case lexer.Fourth:
+		return &FourthStatement{}, nil
+
+	case lexer.Not:
+		return &NotStatement{}, nil
+
+	case lexer.Words:
+		return &WordsStatement{}, nil
+
+	case lexer.Factorial:
+		return &FactorialStatement{}, nil
+
+	case lexer.Erase:
+		return &EraseStatement{}, nil
+
+	case lexer.CompareMem:
+		return &CompareMemStatement{}, nil
+
+	case lexer.UPrint:
+		return &UPrintStatement{}, nil
+
+	case lexer.RDepth:
+		return &RDepthStatement{}, nil
+
+	case lexer.ToBuffer:
+		return &ToBufferStatement{}, nil
+
+	case lexer.FromBuffer:
+		return &FromBufferStatement{}, nil
+
+	case lexer.Sort:
+		return &SortStatement{}, nil
+
+	case lexer.Find:
+		return &FindStatement{}, nil
+
+	case lexer.NumWords:
+		return &NumWordsStatement{}, nil
+
+	case lexer.NumVars:
+		return &NumVarsStatement{}, nil
+
+	case lexer.QExecute:
+		return &QExecuteStatement{}, nil
+
+	case lexer.Overflowed:
+		return &OverflowedStatement{}, nil
+
+	case lexer.Enum, lexer.Value:
+		return nil, fmt.Errorf("%s is only allowed at the top level, found at %s", lit, p.pos())
+
+	case lexer.Getch:
+		return &GetchStatement{}, nil
+
+	case lexer.Type:
+		return &TypeStatement{}, nil
+
+	case lexer.ToR:
+		return &ToRStatement{}, nil
+
+	case lexer.FromR:
+		return &FromRStatement{}, nil
+
+	case lexer.RFetch:
+		return &RFetchStatement{}, nil
+
+	case lexer.TwoToR:
+		return &TwoToRStatement{}, nil
+
+	case lexer.TwoFromR:
+		return &TwoFromRStatement{}, nil
+
+	case lexer.TwoRFetch:
+		return &TwoRFetchStatement{}, nil
+
+	case lexer.Returns:
+		return &ReturnsStatement{}, nil
+
+	case lexer.See:
+		p.unscan()
+		return p.parseSee()
+
+	case lexer.AbortQuote:
+		// the message follows the quote and a space, up to the next quote
+		msg := lit[strings.Index(lit, "\"")+1:]
+		if !strings.HasSuffix(msg, "\"") {
+			return nil, errors.New("expected '\"' after abort\" message")
+		}
+
+		msg = strings.TrimSuffix(msg, "\"")
+		return &AbortStatement{Message: strings.TrimPrefix(msg, " ")}, nil
+
+	case lexer.To:
+		p.unscan()
+		return p.parseTo()
+
+	case lexer.ByteGet:
+		return &ByteGetStatement{}, nil
+
+	case lexer.ByteStore:
+		return &ByteStoreStatement{}, nil
+
+	case lexer.Exit:
+		return &ExitStatement{}, nil
+
+	case lexer.Within:
+		return &WithinStatement{}, nil
+
+	case lexer.DivMod:
+		return &DivModStatement{}, nil
+
+	case lexer.MulDiv:
+		return &MulDivStatement{}, nil
+
+	case lexer.MulDivMod:
+		return &MulDivModStatement{}, nil
+
+	case lexer.Reverse:
+		return &ReverseStatement{}, nil
+
+	case lexer.Allot:
+		return &AllotStatement{}, nil
+
+	case lexer.Here:
+		return &HereStatement{}, nil
+
+	case lexer.CFetch:
+		return &CFetchStatement{}, nil
+
+	case lexer.CStore:
+		return &CStoreStatement{}, nil
+
 	case lexer.Quit:
 		return &QuitStatement{}, nil
 	}
@@ -151,15 +625,18 @@ func (p *Parser) parseCommon() (Statement, error) {
 func (p *Parser) parseVariableDeclaration() (*DeclarationStatement, error) {
 	// discard lexer.Variable
 	p.scan()
+	pos := p.pos()
 
 	tok, lit := p.scan()
 	if tok != lexer.Ident {
 		return nil, errors.New("expected variable identifier")
 	}
+	p.defined[lit] = true
 
 	st := &DeclarationStatement{
 		Name:  lit,
 		Cells: 1,
+		Pos:   pos,
 	}
 
 	tok, nr := p.scan()
@@ -195,6 +672,18 @@ func (p *Parser) parsePushNumber() (*PushNumberStatement, error) {
 	}, nil
 }
 
+func (p *Parser) parsePushFloat() (*PushFloatStatement, error) {
+	_, lit := p.scan()
+	nr, err := strconv.ParseFloat(lit, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PushFloatStatement{
+		Number: nr,
+	}, nil
+}
+
 func (p *Parser) parseIdentifierCall() (*IdentifierCallStatement, error) {
 	_, name := p.scan()
 
@@ -203,10 +692,139 @@ func (p *Parser) parseIdentifierCall() (*IdentifierCallStatement, error) {
 	}, nil
 }
 
-func (p *Parser) parseMathOperation() (MathOperationStatement, error) {
+func (p *Parser) parseTick() (*TickStatement, error) {
+	// scan Tick
+	p.scan()
+
+	tok, lit := p.scan()
+	if tok != lexer.Ident {
+		return nil, errors.New("expected function identifier after '")
+	}
+
+	return &TickStatement{
+		Name: lit,
+	}, nil
+}
+
+func (p *Parser) parseSee() (*SeeStatement, error) {
+	// scan See
+	p.scan()
+
+	tok, lit := p.scan()
+	if tok != lexer.Ident {
+		return nil, errors.New("expected function identifier after see")
+	}
+
+	return &SeeStatement{
+		Name: lit,
+	}, nil
+}
+
+func (p *Parser) parseDefined() (*DefinedStatement, error) {
+	// scan Defined
+	p.scan()
+
+	tok, lit := p.scan()
+	if tok != lexer.Ident {
+		return nil, errors.New("expected identifier after defined?")
+	}
+
+	return &DefinedStatement{
+		Name: lit,
+	}, nil
+}
+
+func (p *Parser) parseAlias() (*AliasStatement, error) {
+	// scan Alias
+	p.scan()
+
+	tok, name := p.scan()
+	if tok != lexer.Ident {
+		return nil, errors.New("expected alias identifier")
+	}
+	p.defined[name] = true
+
+	tok, target := p.scan()
+	if tok != lexer.Ident {
+		return nil, errors.New("expected identifier to alias")
+	}
+
+	return &AliasStatement{
+		Name:   name,
+		Target: target,
+	}, nil
+}
+
+// parseEnum parses enum followed by the names of the constants it defines,
+// which end with the line.
+func (p *Parser) parseEnum() (*EnumStatement, error) {
+	// scan Enum
+	p.scan()
+	pos := p.pos()
+
+	st := &EnumStatement{Pos: pos}
+	for {
+		tok, name := p.scan()
+		if tok != lexer.Ident || p.pos().Line != pos.Line {
+			p.unscan()
+			break
+		}
+
+		p.defined[name] = true
+		st.Names = append(st.Names, name)
+	}
+
+	if len(st.Names) == 0 {
+		return nil, errors.New("expected constant identifier after enum")
+	}
+
+	return st, nil
+}
+
+func (p *Parser) parseValue() (*ValueStatement, error) {
+	// scan Value
+	p.scan()
+	pos := p.pos()
+
+	tok, name := p.scan()
+	if tok != lexer.Ident {
+		return nil, errors.New("expected value identifier")
+	}
+	p.defined[name] = true
+
+	return &ValueStatement{
+		Name: name,
+		Pos:  pos,
+	}, nil
+}
+
+func (p *Parser) parseTo() (*ToStatement, error) {
+	// scan To
+	p.scan()
+
+	tok, name := p.scan()
+	if tok != lexer.Ident {
+		return nil, errors.New("expected value identifier after to")
+	}
+
+	return &ToStatement{
+		Name: name,
+	}, nil
+}
+
+func (p *Parser) parseMathOperation() (*MathOperationStatement, error) {
+	tok, _ := p.scan()
+
+	return &MathOperationStatement{
+		Op:  tok,
+		Pos: p.pos(),
+	}, nil
+}
+
+func (p *Parser) parseUnaryOperation() (UnaryOperationStatement, error) {
 	tok, _ := p.scan()
 
-	return MathOperationStatement(tok), nil
+	return UnaryOperationStatement(tok), nil
 }
 
 func (p *Parser) parseCompareOperation() (CompareOperationStatement, error) {
@@ -218,15 +836,18 @@ func (p *Parser) parseCompareOperation() (CompareOperationStatement, error) {
 func (p *Parser) parseFunc() (*FunctionStatement, error) {
 	// scan FuncStart
 	p.scan()
+	pos := p.pos()
 
 	// get function name
 	tok, lit := p.scan()
 	if tok != lexer.Ident {
 		return nil, errors.New("expected function identifier")
 	}
+	p.defined[lit] = true
 
 	fn := &FunctionStatement{
 		Name: lit,
+		Pos:  pos,
 	}
 
 	for {
@@ -239,13 +860,21 @@ func (p *Parser) parseFunc() (*FunctionStatement, error) {
 			continue
 		}
 
-		tok, _ = p.scan()
+		tok, lit = p.scan()
 		switch tok {
 		case lexer.EndFunc:
 			return fn, nil
 
+		case lexer.Variable:
+			p.unscan()
+			st, err := p.parseVariableDeclaration()
+			if err != nil {
+				return nil, err
+			}
+			fn.Body = append(fn.Body, st)
+
 		default:
-			return nil, errors.New("found invalid token: " + tok.String())
+			return nil, p.invalid(tok, lit)
 		}
 	}
 }
@@ -267,7 +896,7 @@ func (p *Parser) parseIfStatement() (*IfStatement, error) {
 			continue
 		}
 
-		tok, _ := p.scan()
+		tok, lit := p.scan()
 		switch tok {
 		case lexer.Then:
 			return ifst, nil
@@ -280,7 +909,7 @@ func (p *Parser) parseIfStatement() (*IfStatement, error) {
 			body = &ifst.ElseBody
 
 		default:
-			return nil, errors.New("found invalid token: " + tok.String())
+			return nil, p.invalid(tok, lit)
 		}
 	}
 }
@@ -301,13 +930,113 @@ func (p *Parser) parseWhileStatement() (*WhileStatement, error) {
 			continue
 		}
 
-		tok, _ := p.scan()
+		tok, lit := p.scan()
 		switch tok {
 		case lexer.Repeat:
 			return whilest, nil
 
 		default:
-			return nil, errors.New("found invalid token: " + tok.String())
+			return nil, p.invalid(tok, lit)
+		}
+	}
+}
+
+func (p *Parser) parseTimeStatement() (*TimeStatement, error) {
+	// scan Time
+	p.scan()
+
+	timest := &TimeStatement{}
+
+	for {
+		st, err := p.parseCommon()
+		if err != nil {
+			return nil, err
+		}
+		if st != nil {
+			timest.Body = append(timest.Body, st)
+			continue
+		}
+
+		tok, lit := p.scan()
+		switch tok {
+		case lexer.EndTime:
+			return timest, nil
+
+		default:
+			return nil, p.invalid(tok, lit)
+		}
+	}
+}
+
+func (p *Parser) parseCaseStatement() (*CaseStatement, error) {
+	// scan Case
+	p.scan()
+
+	casest := &CaseStatement{}
+
+	for {
+		// a number followed by of starts a clause, anything else is part
+		// of the default body
+		tok, lit := p.scan()
+		if tok == lexer.Number {
+			if ntok, _ := p.scan(); ntok == lexer.Of {
+				clause, err := p.parseCaseClause(lit)
+				if err != nil {
+					return nil, err
+				}
+
+				casest.Cases = append(casest.Cases, clause)
+				continue
+			}
+			p.unscan()
+		}
+		p.unscan()
+
+		st, err := p.parseCommon()
+		if err != nil {
+			return nil, err
+		}
+		if st != nil {
+			casest.Default = append(casest.Default, st)
+			continue
+		}
+
+		tok, lit = p.scan()
+		switch tok {
+		case lexer.EndCase:
+			return casest, nil
+
+		default:
+			return nil, p.invalid(tok, lit)
+		}
+	}
+}
+
+func (p *Parser) parseCaseClause(nr string) (CaseClause, error) {
+	val, err := strconv.Atoi(nr)
+	if err != nil {
+		return CaseClause{}, err
+	}
+
+	clause := CaseClause{Value: val}
+
+	for {
+		st, err := p.parseCommon()
+		if err != nil {
+			return CaseClause{}, err
+		}
+		if st != nil {
+			clause.Body = append(clause.Body, st)
+			continue
+		}
+
+		tok, lit := p.scan()
+		switch tok {
+		case lexer.EndOf:
+			return clause, nil
+
+		default:
+			return CaseClause{}, p.invalid(tok, lit)
 		}
 	}
 }
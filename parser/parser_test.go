@@ -0,0 +1,169 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/noonien/techon/lexer"
+)
+
+func parse(t *testing.T, src string) Program {
+	t.Helper()
+
+	prog, err := NewParser(strings.NewReader(src)).Parse()
+	if err != nil {
+		t.Fatalf("parsing %q: %v", src, err)
+	}
+
+	return prog
+}
+
+func TestFunctionDoc(t *testing.T) {
+	prog := parse(t, "( squares a number,\n  keeping its sign )\n: sq dup * ;\n: cube dup dup * * ;")
+	if len(prog) != 3 {
+		t.Fatalf("got %d statements, want 3", len(prog))
+	}
+
+	c, ok := prog[0].(*Comment)
+	if !ok || !strings.Contains(c.Body, "\n") {
+		t.Fatalf("got %#v, want a multi-line comment", prog[0])
+	}
+
+	sq := prog[1].(*FunctionStatement)
+	if sq.Doc != "squares a number,\n  keeping its sign" {
+		t.Errorf("got doc %q", sq.Doc)
+	}
+
+	cube := prog[2].(*FunctionStatement)
+	if cube.Doc != "" {
+		t.Errorf("got doc %q for an undocumented function", cube.Doc)
+	}
+}
+
+func TestParseAll(t *testing.T) {
+	progs, err := NewParser(strings.NewReader("1 2\n---\n: f 1 ;\n--- 3")).ParseAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(progs) != 3 {
+		t.Fatalf("got %d programs, want 3", len(progs))
+	}
+
+	for i, n := range []int{2, 1, 1} {
+		if len(progs[i]) != n {
+			t.Errorf("program %d: got %d statements, want %d", i, len(progs[i]), n)
+		}
+	}
+
+	_, err = NewParser(strings.NewReader("1\n---\n: f")).ParseAll()
+	if err == nil {
+		t.Error("a parse error in a later program was not reported")
+	}
+}
+
+func TestParserOptions(t *testing.T) {
+	prog, err := NewParser(strings.NewReader(": DUP 1 ; DUP dup"), lexer.CaseSensitiveKeywords(true)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(prog) != 3 {
+		t.Fatalf("got %d statements, want 3", len(prog))
+	}
+
+	if call, ok := prog[1].(*IdentifierCallStatement); !ok || call.Identifier != "DUP" {
+		t.Errorf("got %#v, want a call to DUP", prog[1])
+	}
+
+	if _, ok := prog[2].(*DupStatement); !ok {
+		t.Errorf("got %#v, want dup", prog[2])
+	}
+}
+
+func TestIllegalCharacter(t *testing.T) {
+	_, err := NewParser(strings.NewReader("1 2\n3 dup + &")).Parse()
+
+	want := "unexpected character '&' at line 2, col 9"
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v, want %s", err, want)
+	}
+}
+
+func TestNext(t *testing.T) {
+	p := NewParser(strings.NewReader(": f 1 if 2 then ; 3 while 4 repeat (done) f"))
+
+	var types []string
+	for {
+		st, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		types = append(types, fmt.Sprintf("%T", st))
+	}
+
+	want := "[*parser.FunctionStatement *parser.PushNumberStatement *parser.WhileStatement *parser.Comment *parser.IdentifierCallStatement]"
+	if got := fmt.Sprint(types); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	if _, err := p.Next(); err != io.EOF {
+		t.Errorf("got %v after the end, want io.EOF", err)
+	}
+}
+
+func TestParseRecover(t *testing.T) {
+	prog, errs := ParseRecover(strings.NewReader("1 & 2\n3\n: f 4 ;\n5 ~ 6\nvariable x"))
+
+	if len(errs) != 2 {
+		t.Fatalf("got errors %v, want 2", errs)
+	}
+
+	for i, line := range []string{"line 1", "line 4"} {
+		if !strings.Contains(errs[i].Error(), line) {
+			t.Errorf("error %d: got %v, want it at %s", i, errs[i], line)
+		}
+	}
+
+	var types []string
+	for _, st := range prog {
+		types = append(types, fmt.Sprintf("%T", st))
+	}
+
+	want := "[*parser.PushNumberStatement *parser.PushNumberStatement *parser.FunctionStatement *parser.PushNumberStatement *parser.DeclarationStatement]"
+	if got := fmt.Sprint(types); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestConditional(t *testing.T) {
+	tests := []struct {
+		src  string
+		want int
+	}{
+		{": f ; [if] f 1 2 [then] 3", 4},
+		{"[if] f 1 2 [then] 3", 1},
+		{"variable x [if] x 1 [then]", 2},
+		{": f ; [if] f [if] g 1 [then] 2 [then]", 2},
+		{"[if] g [if] f 1 [then] 2 [then] 3", 1},
+	}
+
+	for _, tt := range tests {
+		if got := len(parse(t, tt.src)); got != tt.want {
+			t.Errorf("%q: got %d statements, want %d", tt.src, got, tt.want)
+		}
+	}
+
+	for _, src := range []string{"[if] 5 [then]", ": f [if] 5 [then] ;", "[if]"} {
+		_, err := NewParser(strings.NewReader(src)).Parse()
+		if err == nil || !strings.Contains(err.Error(), "expected a name after [if]") {
+			t.Errorf("%q: got %v, want a missing name error", src, err)
+		}
+	}
+}
@@ -10,12 +10,17 @@ type Statement interface {
 type DeclarationStatement struct {
 	Name  string
 	Cells int
+	Pos   lexer.Pos
 }
 
 type PushNumberStatement struct {
 	Number int
 }
 
+type PushFloatStatement struct {
+	Number float64
+}
+
 type IdentifierCallStatement struct {
 	Identifier string
 }
@@ -26,6 +31,10 @@ type DupStatement struct{}
 
 type SwapStatement struct{}
 
+type TwoOverStatement struct{}
+
+type TwoNipStatement struct{}
+
 type Comment struct {
 	Body string
 }
@@ -34,13 +43,79 @@ type GetStatement struct{}
 
 type StoreStatement struct{}
 
-type MathOperationStatement lexer.Token
+type PrintStatement struct{}
+
+type HexStatement struct{}
+
+type DecimalStatement struct{}
+
+// MathOperationStatement applies the arithmetic operator Op, found at Pos,
+// to the top two items.
+type MathOperationStatement struct {
+	Op  lexer.Token
+	Pos lexer.Pos
+}
+
+type UnaryOperationStatement lexer.Token
 
 type CompareOperationStatement lexer.Token
 
+// TickStatement pushes the execution token of the function Name.
+type TickStatement struct {
+	Name string
+}
+
+type ExecuteStatement struct{}
+
+// AliasStatement makes Name another name for the function, constant or
+// registered word Target.
+type AliasStatement struct {
+	Name   string
+	Target string
+}
+
+// EnumStatement defines Names as constants numbered from zero in order. It
+// only appears at the top level.
+type EnumStatement struct {
+	Names []string
+	Pos   lexer.Pos
+}
+
+// SeeStatement prints the definition of the function Name.
+type SeeStatement struct {
+	Name string
+}
+
+// AbortStatement pops a flag and fails with Message if it is nonzero.
+type AbortStatement struct {
+	Message string
+}
+
+// ValueStatement pops a number and defines the value Name holding it. Unlike
+// variables, values are always global, so it only appears at the top level.
+type ValueStatement struct {
+	Name string
+	Pos  lexer.Pos
+}
+
+// ToStatement pops a number and assigns it to the value Name.
+type ToStatement struct {
+	Name string
+}
+
+// DefinedStatement pushes 1 if Name is a variable, function or registered
+// word, 0 otherwise.
+type DefinedStatement struct {
+	Name string
+}
+
 type FunctionStatement struct {
 	Name string
 	Body []Statement
+	Pos  lexer.Pos
+
+	// Doc is the body of the comment immediately preceding the function.
+	Doc string
 }
 
 type IfStatement struct {
@@ -52,4 +127,143 @@ type WhileStatement struct {
 	Body []Statement
 }
 
+// TimeStatement runs Body and prints how long it took.
+type TimeStatement struct {
+	Body []Statement
+}
+
+// CaseStatement runs the body of the clause matching the value on top of the
+// stack, or Default if none does.
+type CaseStatement struct {
+	Cases   []CaseClause
+	Default []Statement
+}
+
+type CaseClause struct {
+	Value int
+	Body  []Statement
+}
+
+type LeaveStatement struct{}
+
 type QuitStatement struct{}
+
+type QDupStatement struct{}
+
+type PrintStackStatement struct{}
+
+type FillStatement struct{}
+
+type MoveStatement struct{}
+
+type SizeStatement struct{}
+
+type DumpStatement struct{}
+
+type MaxIntStatement struct{}
+
+type MinIntStatement struct{}
+
+type MarkStatement struct{}
+
+type ArityStatement struct{}
+
+type BoolStatement struct{}
+
+type FlagStatement struct{}
+
+type SqrtStatement struct{}
+
+type GcdStatement struct{}
+
+type LcmStatement struct{}
+
+type RollAllStatement struct{}
+
+type EmptyStatement struct{}
+
+type CellPlusStatement struct{}
+
+type ReadStatement struct{}
+
+type ModPowStatement struct{}
+
+type RandomStatement struct{}
+
+type HashStatement struct{}
+
+type ThirdStatement struct{}
+
+type FourthStatement struct{}
+
+type NotStatement struct{}
+
+type WordsStatement struct{}
+
+type FactorialStatement struct{}
+
+type EraseStatement struct{}
+
+type CompareMemStatement struct{}
+
+type UPrintStatement struct{}
+
+type RDepthStatement struct{}
+
+type ToBufferStatement struct{}
+
+type FromBufferStatement struct{}
+
+type SortStatement struct{}
+
+type FindStatement struct{}
+
+type NumWordsStatement struct{}
+
+type NumVarsStatement struct{}
+
+type QExecuteStatement struct{}
+
+type OverflowedStatement struct{}
+
+type GetchStatement struct{}
+
+type TypeStatement struct{}
+
+type ToRStatement struct{}
+
+type FromRStatement struct{}
+
+type RFetchStatement struct{}
+
+type TwoToRStatement struct{}
+
+type TwoFromRStatement struct{}
+
+type TwoRFetchStatement struct{}
+
+type ReturnsStatement struct{}
+
+type ByteGetStatement struct{}
+
+type ByteStoreStatement struct{}
+
+type ExitStatement struct{}
+
+type WithinStatement struct{}
+
+type DivModStatement struct{}
+
+type MulDivStatement struct{}
+
+type MulDivModStatement struct{}
+
+type ReverseStatement struct{}
+
+type AllotStatement struct{}
+
+type HereStatement struct{}
+
+type CFetchStatement struct{}
+
+type CStoreStatement struct{}
@@ -0,0 +1,33 @@
+package parser
+
+// Walk calls fn for every statement in body in source order, descending into
+// the bodies of functions, ifs, loops, cases and time blocks. If fn returns
+// false the children of that statement are skipped.
+func Walk(body []Statement, fn func(Statement) bool) {
+	for _, st := range body {
+		if !fn(st) {
+			continue
+		}
+
+		switch st := st.(type) {
+		case *FunctionStatement:
+			Walk(st.Body, fn)
+
+		case *IfStatement:
+			Walk(st.Body, fn)
+			Walk(st.ElseBody, fn)
+
+		case *WhileStatement:
+			Walk(st.Body, fn)
+
+		case *TimeStatement:
+			Walk(st.Body, fn)
+
+		case *CaseStatement:
+			for _, clause := range st.Cases {
+				Walk(clause.Body, fn)
+			}
+			Walk(st.Default, fn)
+		}
+	}
+}
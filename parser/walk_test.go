@@ -0,0 +1,36 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	prog, err := NewParser(strings.NewReader(": f 1 if a else b then while c repeat ; d")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var idents []string
+	Walk(prog, func(st Statement) bool {
+		if st, ok := st.(*IdentifierCallStatement); ok {
+			idents = append(idents, st.Identifier)
+		}
+		return true
+	})
+
+	if got := strings.Join(idents, " "); got != "a b c d" {
+		t.Errorf("got %q, want \"a b c d\"", got)
+	}
+
+	var count int
+	Walk(prog, func(st Statement) bool {
+		count++
+		_, isFunc := st.(*FunctionStatement)
+		return !isFunc
+	})
+
+	if count != 2 {
+		t.Errorf("visited %d statements skipping function bodies, want 2", count)
+	}
+}
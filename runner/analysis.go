@@ -0,0 +1,175 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/noonien/techon/lexer"
+	"github.com/noonien/techon/parser"
+)
+
+// Warning is a problem found by static analysis which does not prevent the
+// program from running.
+type Warning struct {
+	Message string
+	Pos     lexer.Pos
+}
+
+func (w Warning) String() string {
+	if w.Pos.Line == 0 {
+		return w.Message
+	}
+
+	return w.Pos.String() + ": " + w.Message
+}
+
+// Analyze reports variables and functions that are declared but never
+// referenced by name. Functions named main, in any case, count as used,
+// since programs can be run by calling main and names may ignore case.
+func Analyze(prog parser.Program) []Warning {
+	var decls []parser.Statement
+	used := make(map[string]bool)
+
+	parser.Walk(prog, func(st parser.Statement) bool {
+		switch st := st.(type) {
+		case *parser.DeclarationStatement, *parser.FunctionStatement:
+			decls = append(decls, st)
+
+		case *parser.IdentifierCallStatement:
+			used[st.Identifier] = true
+
+		case *parser.TickStatement:
+			used[st.Name] = true
+
+		case *parser.AliasStatement:
+			used[st.Target] = true
+		}
+
+		return true
+	})
+
+	var warnings []Warning
+	for _, st := range decls {
+		switch st := st.(type) {
+		case *parser.DeclarationStatement:
+			if !used[st.Name] {
+				warnings = append(warnings, Warning{
+					Message: "variable \"" + st.Name + "\" is never used",
+					Pos:     st.Pos,
+				})
+			}
+
+		case *parser.FunctionStatement:
+			if !used[st.Name] && strings.ToLower(st.Name) != "main" {
+				warnings = append(warnings, Warning{
+					Message: "function \"" + st.Name + "\" is never used",
+					Pos:     st.Pos,
+				})
+			}
+		}
+	}
+
+	return warnings
+}
+
+// CheckStackEffects compares the stack effect functions document with the one
+// estimated the way StackCheck does, and warns about functions that clearly
+// do not match. The effect is written as a comment of the form ( a b -- c ),
+// either right before the function or first in its body, with any names
+// for the items taken and returned on each side of the -- (or ---).
+//
+// Functions whose effect cannot be estimated, for example because they
+// contain loops or call other functions, are not reported.
+func CheckStackEffects(prog parser.Program) []Warning {
+	vars := make(map[string]bool)
+	for _, st := range prog {
+		if st, ok := st.(*parser.DeclarationStatement); ok {
+			vars[st.Name] = true
+		}
+	}
+
+	var warnings []Warning
+	for _, st := range prog {
+		fn, ok := st.(*parser.FunctionStatement)
+		if !ok {
+			continue
+		}
+
+		in, out, ok := declaredEffect(fn)
+		if !ok {
+			continue
+		}
+
+		c := &stackChecker{vars: make(map[string]bool)}
+		for name := range vars {
+			c.vars[name] = true
+		}
+		for _, st := range fn.Body {
+			if decl, ok := st.(*parser.DeclarationStatement); ok {
+				c.vars[decl.Name] = true
+			}
+		}
+
+		d, ok, err := c.check(fn.Body, depthRange{min: in, max: in})
+		effect := fmt.Sprintf("function %q has stack effect ( %d -- %d )", fn.Name, in, out)
+
+		var underflow *StackUnderflowError
+		switch {
+		case errors.As(err, &underflow):
+			warnings = append(warnings, Warning{
+				Message: effect + ", but " + err.Error(),
+				Pos:     fn.Pos,
+			})
+
+		case ok && (out < d.min || out > d.max):
+			left := fmt.Sprint(d.min)
+			if d.min != d.max {
+				left = fmt.Sprintf("%d to %d", d.min, d.max)
+			}
+
+			warnings = append(warnings, Warning{
+				Message: effect + ", but leaves " + left,
+				Pos:     fn.Pos,
+			})
+		}
+	}
+
+	return warnings
+}
+
+// declaredEffect returns the number of items fn documents taking and
+// returning.
+func declaredEffect(fn *parser.FunctionStatement) (in, out int, ok bool) {
+	if len(fn.Body) > 0 {
+		if c, isComment := fn.Body[0].(*parser.Comment); isComment {
+			in, out, ok = parseStackEffect(c.Body)
+			if ok {
+				return in, out, true
+			}
+		}
+	}
+
+	return parseStackEffect(fn.Doc)
+}
+
+// parseStackEffect parses a stack effect comment, "a b -- c".
+func parseStackEffect(comment string) (in, out int, ok bool) {
+	fields := strings.Fields(comment)
+
+	sep := -1
+	for i, field := range fields {
+		if field == "--" || field == "---" {
+			if sep >= 0 {
+				return 0, 0, false
+			}
+			sep = i
+		}
+	}
+
+	if sep < 0 {
+		return 0, 0, false
+	}
+
+	return sep, len(fields) - sep - 1, true
+}
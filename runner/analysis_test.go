@@ -0,0 +1,64 @@
+package runner
+
+import "testing"
+
+func TestAnalyze(t *testing.T) {
+	prog := parse(t, `variable used
+variable unused
+: helper used @ ;
+: dead 1 ;
+: entry helper ;
+entry`)
+
+	warnings := Analyze(prog)
+	want := []string{
+		`line 2, col 1: variable "unused" is never used`,
+		`line 4, col 1: function "dead" is never used`,
+	}
+
+	if len(warnings) != len(want) {
+		t.Fatalf("got %v, want %v", warnings, want)
+	}
+
+	for i, w := range warnings {
+		if w.String() != want[i] {
+			t.Errorf("warning %d: got %q, want %q", i, w, want[i])
+		}
+	}
+}
+
+func TestAnalyzeMain(t *testing.T) {
+	for _, src := range []string{": main 1 ;", ": MAIN 1 ;", ": helper 1 ; : main helper ;"} {
+		if warnings := Analyze(parse(t, src)); len(warnings) != 0 {
+			t.Errorf("%q: got %v, want no warnings", src, warnings)
+		}
+	}
+}
+
+func TestCheckStackEffects(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{": sq ( n -- n*n ) dup * ;", ""},
+		{"( a b -- sum )\n: add + ;", ""},
+		{": sq ( n -- n*n ) dup ;", `line 1, col 1: function "sq" has stack effect ( 1 -- 1 ), but leaves 2`},
+		{": f ( -- x ) drop ;", `line 1, col 1: function "f" has stack effect ( 0 -- 1 ), but cannot perform drop, stack empty`},
+		{": f ( n -- ) if 1 then ;", ""},
+		{": f ( n -- a b ) if 1 then ;", `line 1, col 1: function "f" has stack effect ( 1 -- 2 ), but leaves 0 to 1`},
+		{": f ( n -- m ) 1 while 0 repeat ;", ""},
+		{": f ( just a comment ) 1 ;", ""},
+	}
+
+	for _, tt := range tests {
+		warnings := CheckStackEffects(parse(t, tt.src))
+
+		var got string
+		if len(warnings) > 0 {
+			got = warnings[0].String()
+		}
+		if len(warnings) > 1 || got != tt.want {
+			t.Errorf("%q: got %v, want %q", tt.src, warnings, tt.want)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package runner
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/noonien/techon/parser"
+)
+
+// Compiled is a program flattened into a list of instructions, with ifs and
+// loops turned into jumps. It is run by Run instead of walking the tree.
+type Compiled struct {
+	code []instruction
+}
+
+// instruction is either a call to a statement handler or a jump.
+type instruction struct {
+	// run executes st. Jumps have no run function.
+	run func(m *Machine) error
+	st  parser.Statement
+
+	// cond is the name of the operation popping the condition of a
+	// conditional jump, which is taken when the condition is zero. Jumps
+	// without a condition are always taken.
+	cond string
+
+	// target is the index of the instruction a jump continues at.
+	target int
+
+	// exit is the index of the instruction following the innermost
+	// enclosing loop, or -1 outside of loops. A leave continues there.
+	exit int
+
+	// name is the statement type counted when profiling, if any.
+	name string
+
+	// blocks describes the ifs and loops enclosing the instruction,
+	// outermost first, used to add context to errors.
+	blocks []string
+}
+
+type compiler struct {
+	code   []instruction
+	blocks []string
+	exit   int
+}
+
+// Compile flattens prog into a Compiled program. Like Execute, the top-level
+// declarations are run first, and a program made only of declarations and
+// comments is run by calling its main function. The bodies of the functions
+// it declares are compiled as well, and run compiled whenever they are
+// called on the machine the program runs on.
+//
+// Case statements and time blocks are still run by the interpreter.
+//
+// A leave outside of any loop or an exit outside of any function has nowhere
+// to jump to, so programs containing one fail to compile with
+// ErrLeaveOutsideLoop or ErrExitOutsideFunction, even if it is never reached.
+func Compile(prog parser.Program) (*Compiled, error) {
+	err := checkControl(prog, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &compiler{exit: -1}
+
+	// which function is main depends on CaseInsensitiveIdentifiers, so it
+	// is only picked when running
+	var mains []*parser.FunctionStatement
+	for _, st := range prog {
+		if isDeclaration(st) {
+			c.statement(st)
+		}
+
+		if fn, ok := st.(*parser.FunctionStatement); ok && strings.EqualFold(fn.Name, "main") {
+			mains = append(mains, fn)
+		}
+	}
+
+	for _, st := range prog {
+		if isDeclaration(st) {
+			continue
+		}
+
+		if _, ok := st.(*parser.Comment); !ok {
+			mains = nil
+		}
+
+		c.statement(st)
+	}
+
+	if len(mains) > 0 {
+		c.emit(instruction{
+			run: func(m *Machine) error {
+				for _, fn := range mains {
+					if m.key(fn.Name) == m.key("main") {
+						return m.call(fn)
+					}
+				}
+
+				return nil
+			},
+			st: &parser.IdentifierCallStatement{Identifier: "main"},
+		})
+	}
+
+	return &Compiled{code: c.code}, nil
+}
+
+// checkControl fails if body has a leave outside of any loop or an exit
+// outside of any function. loop and function tell whether body is inside one.
+func checkControl(body []parser.Statement, loop, function bool) error {
+	var err error
+	parser.Walk(body, func(st parser.Statement) bool {
+		if err != nil {
+			return false
+		}
+
+		switch st := st.(type) {
+		case *parser.LeaveStatement:
+			if !loop {
+				err = ErrLeaveOutsideLoop
+			}
+
+		case *parser.ExitStatement:
+			if !function {
+				err = ErrExitOutsideFunction
+			}
+
+		case *parser.WhileStatement:
+			err = checkControl(st.Body, true, function)
+			return false
+
+		case *parser.FunctionStatement:
+			// a leave cannot stop the loop a function is called from
+			err = checkControl(st.Body, false, true)
+			return false
+		}
+
+		return true
+	})
+
+	return err
+}
+
+// compileBody flattens the body of a function.
+func compileBody(body []parser.Statement) *Compiled {
+	c := &compiler{exit: -1}
+	for _, st := range body {
+		c.statement(st)
+	}
+
+	return &Compiled{code: c.code}
+}
+
+// emit appends in to the code and returns its index.
+func (c *compiler) emit(in instruction) int {
+	in.exit = c.exit
+	in.blocks = c.blocks
+	c.code = append(c.code, in)
+	return len(c.code) - 1
+}
+
+func (c *compiler) body(body []parser.Statement, block string) {
+	blocks := c.blocks
+	c.blocks = append(blocks[:len(blocks):len(blocks)], block)
+
+	for _, st := range body {
+		c.statement(st)
+	}
+
+	c.blocks = blocks
+}
+
+func (c *compiler) statement(st parser.Statement) {
+	switch st := st.(type) {
+	case *parser.IfStatement:
+		jump := c.emit(instruction{cond: "if", name: "IfStatement"})
+		c.body(st.Body, "in if")
+
+		if len(st.ElseBody) > 0 {
+			end := c.emit(instruction{})
+			c.code[jump].target = len(c.code)
+			c.body(st.ElseBody, "in else")
+			jump = end
+		}
+
+		c.code[jump].target = len(c.code)
+
+	case *parser.WhileStatement:
+		c.emit(instruction{name: "WhileStatement", target: len(c.code) + 1})
+		head := c.emit(instruction{cond: "while"})
+
+		exit := c.exit
+		c.exit = -2 // patched below, once the end is known
+		c.body(st.Body, "in while loop")
+		c.exit = exit
+
+		c.emit(instruction{target: head})
+
+		end := len(c.code)
+		c.code[head].target = end
+		for i := head + 1; i < end; i++ {
+			if c.code[i].exit == -2 {
+				c.code[i].exit = end
+			}
+		}
+
+	case *parser.FunctionStatement:
+		body := compileBody(st.Body)
+		c.emit(instruction{
+			run: func(m *Machine) error {
+				err := m.exec(st)
+				if err != nil {
+					return err
+				}
+
+				if m.compiled == nil {
+					m.compiled = make(map[*parser.FunctionStatement]*Compiled)
+				}
+				m.compiled[st] = body
+				return nil
+			},
+			st: st,
+		})
+
+	default:
+		c.emit(handler(st))
+	}
+}
+
+// handler returns an instruction calling the handler of st directly for
+// common statements, and going through exec for the rest.
+func handler(st parser.Statement) instruction {
+	var run func(m *Machine) error
+
+	switch st := st.(type) {
+	case *parser.PushNumberStatement:
+		run = func(m *Machine) error { return m.pushNumber(st) }
+	case *parser.IdentifierCallStatement:
+		run = func(m *Machine) error { return m.indentifierCall(st) }
+	case *parser.MathOperationStatement:
+		run = func(m *Machine) error { return m.mathOperation(st) }
+	case parser.UnaryOperationStatement:
+		run = func(m *Machine) error { return m.unaryOperation(st) }
+	case parser.CompareOperationStatement:
+		run = func(m *Machine) error { return m.compare(st) }
+	case *parser.DropStatement:
+		run = func(m *Machine) error { return m.drop(st) }
+	case *parser.DupStatement:
+		run = func(m *Machine) error { return m.dup(st) }
+	case *parser.SwapStatement:
+		run = func(m *Machine) error { return m.swap(st) }
+	case *parser.GetStatement:
+		run = func(m *Machine) error { return m.get(st) }
+	case *parser.StoreStatement:
+		run = func(m *Machine) error { return m.store(st) }
+	case *parser.LeaveStatement:
+		run = func(m *Machine) error { return errLeave }
+
+	default:
+		// exec does its own profiling
+		return instruction{run: func(m *Machine) error { return m.exec(st) }, st: st}
+	}
+
+	return instruction{run: run, st: st, name: statementName(st)}
+}
+
+// Run executes c on m, leaving the result on m's stack. It behaves like
+// Execute on the program c was compiled from.
+func (c *Compiled) Run(m *Machine) error {
+	var err error
+	for pc := 0; pc < len(c.code); {
+		pc, err = c.step(m, pc)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// step executes the instruction at pc of a top-level program and returns the
+// index of the next one. Reaching the end of the code, or a quit, returns
+// len(c.code).
+func (c *Compiled) step(m *Machine, pc int) (int, error) {
+	next, err := c.next(m, pc)
+	if errors.Is(err, errQuit) {
+		return len(c.code), m.topLevel(err)
+	}
+
+	return next, m.topLevel(err)
+}
+
+// exec executes c as the body of a function. Control flow errors are
+// returned for the caller to handle, as the interpreter does.
+func (c *Compiled) exec(m *Machine) error {
+	var err error
+	for pc := 0; pc < len(c.code); {
+		pc, err = c.next(m, pc)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// next executes the instruction at pc and returns the index of the next one.
+// A leave inside a loop continues after it, other control flow errors are
+// returned.
+func (c *Compiled) next(m *Machine, pc int) (int, error) {
+	in := &c.code[pc]
+	if m.profile != nil && in.name != "" {
+		m.profile[in.name]++
+	}
+
+	if in.run != nil {
+		err := in.run(m)
+		if err == errLeave && in.exit >= 0 {
+			return in.exit, nil
+		}
+		if err != nil {
+			return pc, c.fail(in, err)
+		}
+
+		return pc + 1, nil
+	}
+
+	if in.cond != "" {
+		err := m.need(in.cond, 1)
+		if err != nil {
+			return pc, c.fail(in, err)
+		}
+
+		val := m.Stack[len(m.Stack)-1]
+		m.Stack = m.Stack[:len(m.Stack)-1]
+
+		if !val.IsZero() {
+			return pc + 1, nil
+		}
+	}
+
+	return in.target, nil
+}
+
+// fail adds the context of the blocks enclosing in to err, the way the
+// interpreter does as errors unwind.
+func (c *Compiled) fail(in *instruction, err error) error {
+	for i := len(in.blocks) - 1; i >= 0; i-- {
+		err = withContext(err, "%s", in.blocks[i])
+	}
+
+	return err
+}
@@ -0,0 +1,136 @@
+package runner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// equivalencePrograms exercise control flow inside and outside functions.
+var equivalencePrograms = []string{
+	"1 2 + 3 * .",
+	"1 if 2 else 3 then 0 if 4 else 5 then",
+	"5 dup while 1- dup repeat",
+	"3 dup while 1- dup 1 = if leave then dup repeat",
+	": sq dup * ; 7 sq",
+	": fact dup 1 > if dup 1- fact * then ; 10 fact",
+	": down dup if 1- down then ; 10000 down",
+	": f 1 while 2 leave 3 repeat 4 ; f",
+	": f 1 if 2 exit then 3 ; f 5",
+	": f variable l 4 l ! l @ ; f f",
+	": g 1 quit 2 ; 0 g 3",
+	": main 42 ; 1",
+	": main 42 ;",
+	": main 42 ; main",
+	"2 case 1 of 10 endof 2 of 20 endof endcase",
+	": f 1 0 / ; f",
+	": f 1 if drop drop then ; f",
+	": f 3 while 1- dup if dup . then dup repeat ; f",
+}
+
+func TestCompiledEquivalence(t *testing.T) {
+	for _, src := range equivalencePrograms {
+		var want, got bytes.Buffer
+
+		m := NewMachine()
+		m.SetOutput(&want)
+		wantErr := m.Execute(parse(t, src))
+		fmt.Fprint(&want, m.Stack)
+
+		m = NewMachine()
+		m.SetOutput(&got)
+		gotErr := compile(t, src).Run(m)
+		fmt.Fprint(&got, m.Stack)
+
+		if fmt.Sprint(gotErr) != fmt.Sprint(wantErr) {
+			t.Errorf("%q: got error %v, want %v", src, gotErr, wantErr)
+		}
+
+		if got.String() != want.String() {
+			t.Errorf("%q: got %q, want %q", src, got.String(), want.String())
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want error
+	}{
+		{"leave", ErrLeaveOutsideLoop},
+		{"0 if leave then", ErrLeaveOutsideLoop},
+		{": f leave ; 1 while f repeat", ErrLeaveOutsideLoop},
+		{"1 case 1 of leave endof endcase", ErrLeaveOutsideLoop},
+		{"exit", ErrExitOutsideFunction},
+		{"1 while exit repeat", ErrExitOutsideFunction},
+	}
+
+	for _, tt := range tests {
+		_, err := Compile(parse(t, tt.src))
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.src, err, tt.want)
+		}
+	}
+
+	for _, src := range []string{
+		"1 while leave repeat",
+		"1 while 1 case 1 of leave endof endcase repeat",
+		": f 1 while exit repeat ; : g 1 if exit then ;",
+	} {
+		if _, err := Compile(parse(t, src)); err != nil {
+			t.Errorf("%q: %v", src, err)
+		}
+	}
+}
+
+func TestCompiledFunctionBodies(t *testing.T) {
+	m := NewMachine()
+	err := compile(t, ": a 1 ; : b a a + ; b").Run(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.compiled) != 2 {
+		t.Errorf("got %d compiled functions, want 2", len(m.compiled))
+	}
+
+	// functions are run compiled when called from interpreted code too
+	err = run(t, m, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := fmt.Sprint(m.Stack); got != "[2 2]" {
+		t.Errorf("got %s, want [2 2]", got)
+	}
+}
+
+// benchmarkSource spends its time calling functions and looping.
+const benchmarkSource = `
+: fib dup 1 > if dup 1- fib swap 2 - fib + then ;
+: count 0 swap dup while swap 1+ swap 1- dup repeat drop ;
+18 fib 20000 count
+`
+
+func BenchmarkInterpreted(b *testing.B) {
+	prog := parse(b, benchmarkSource)
+
+	for i := 0; i < b.N; i++ {
+		err := NewMachine().Execute(prog)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCompiled(b *testing.B) {
+	code := compile(b, benchmarkSource)
+
+	for i := 0; i < b.N; i++ {
+		err := code.Run(NewMachine())
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
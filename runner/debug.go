@@ -0,0 +1,141 @@
+package runner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/noonien/techon/parser"
+)
+
+// Debugger runs a program one statement at a time, driven by commands read
+// from an input:
+//
+//	step, s      execute the next statement
+//	continue, c  run the program to the end
+//	print, p     print the stack
+//
+// Calls to functions are executed as a single step.
+type Debugger struct {
+	m   *Machine
+	in  *bufio.Scanner
+	out io.Writer
+
+	code *Compiled
+	pc   int
+}
+
+// NewDebugger returns a Debugger running programs on m, reading commands
+// from in and writing its output to out.
+func NewDebugger(m *Machine, in io.Reader, out io.Writer) *Debugger {
+	return &Debugger{
+		m:   m,
+		in:  bufio.NewScanner(in),
+		out: out,
+	}
+}
+
+// Load prepares prog to be debugged, stopping before its first statement.
+func (d *Debugger) Load(prog parser.Program) error {
+	code, err := Compile(prog)
+	if err != nil {
+		return err
+	}
+
+	d.code = code
+	d.pc = 0
+	d.skipJumps()
+	return nil
+}
+
+// Done reports whether the loaded program has finished.
+func (d *Debugger) Done() bool {
+	return d.code == nil || d.pc >= len(d.code.code)
+}
+
+// Step executes the next statement of the loaded program.
+func (d *Debugger) Step() error {
+	if d.Done() {
+		return nil
+	}
+
+	pc, err := d.code.step(d.m, d.pc)
+	if err != nil {
+		return err
+	}
+
+	d.pc = pc
+	d.skipJumps()
+	return nil
+}
+
+// skipJumps moves past unconditional jumps, which are not statements of
+// the program.
+func (d *Debugger) skipJumps() {
+	code := d.code.code
+	for d.pc < len(code) && code[d.pc].run == nil && code[d.pc].cond == "" {
+		d.pc = code[d.pc].target
+	}
+}
+
+// Run reads and executes commands until the program finishes or the input
+// ends. Before each command it prints the statement about to be executed.
+func (d *Debugger) Run() error {
+	for !d.Done() {
+		_, err := fmt.Fprintf(d.out, "at %s\n", d.current())
+		if err != nil {
+			return err
+		}
+
+		if !d.in.Scan() {
+			return d.in.Err()
+		}
+
+		switch cmd := strings.TrimSpace(d.in.Text()); cmd {
+		case "step", "s":
+			err = d.Step()
+
+		case "continue", "c":
+			for err == nil && !d.Done() {
+				err = d.Step()
+			}
+
+		case "print", "p":
+			err = d.m.writeStack(d.out)
+			if err == nil {
+				_, err = fmt.Fprintln(d.out)
+			}
+
+		default:
+			_, err = fmt.Fprintf(d.out, "unknown command %q\n", cmd)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintln(d.out, "program finished")
+	return err
+}
+
+// current describes the statement about to be executed.
+func (d *Debugger) current() string {
+	in := &d.code.code[d.pc]
+	if in.run == nil {
+		return strings.ToUpper(in.cond)
+	}
+
+	switch st := in.st.(type) {
+	case *parser.FunctionStatement:
+		return "FUNC " + st.Name
+
+	case *parser.CaseStatement:
+		return "CASE"
+	}
+
+	var b strings.Builder
+	disassembleStatement(&b, in.st, 0)
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,116 @@
+package runner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDebugger(t *testing.T) {
+	var out bytes.Buffer
+	m := NewMachine()
+	m.SetOutput(&out)
+
+	cmds := "s\np\ns\ns\np\nbogus\nc\n"
+	d := NewDebugger(m, strings.NewReader(cmds), &out)
+
+	err := d.Load(parse(t, ": sq dup * ; 3 sq 1 if 2 then ."))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `at FUNC sq
+at PUSH 3
+<0> 
+at PUSH 3
+at CALL sq
+at PUSH 1
+<1> 9 
+at PUSH 1
+unknown command "bogus"
+at PUSH 1
+2 program finished
+`
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	if !d.Done() {
+		t.Error("the program is not done")
+	}
+}
+
+func TestDebuggerStep(t *testing.T) {
+	m := NewMachine()
+	d := NewDebugger(m, strings.NewReader(""), &bytes.Buffer{})
+
+	err := d.Load(parse(t, "1 0 while 5 repeat 2 +"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var steps int
+	for !d.Done() {
+		err = d.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+		steps++
+	}
+
+	if steps != 5 {
+		t.Errorf("took %d steps, want 5", steps)
+	}
+
+	if got := fmt.Sprint(m.Stack); got != "[3]" {
+		t.Errorf("got %s, want [3]", got)
+	}
+}
+
+func TestBreakpoints(t *testing.T) {
+	m := NewMachine()
+
+	var depths []int
+	m.SetBreakpoint("f", func(m *Machine) {
+		depths = append(depths, len(m.Stack))
+	})
+
+	err := run(t, m, ": f drop ; : g 1 ; 1 2 f g f")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := fmt.Sprint(depths); got != "[2 2]" {
+		t.Errorf("breakpoint saw stack depths %s, want [2 2]", got)
+	}
+
+	m.SetBreakpoint("f", nil)
+	err = run(t, m, "1 f")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(depths) != 2 {
+		t.Error("the breakpoint was not cleared")
+	}
+}
+
+func TestDebuggerLoadError(t *testing.T) {
+	d := NewDebugger(NewMachine(), strings.NewReader(""), io.Discard)
+
+	err := d.Load(parse(t, "1 leave"))
+	if !errors.Is(err, ErrLeaveOutsideLoop) {
+		t.Errorf("got %v, want ErrLeaveOutsideLoop", err)
+	}
+	if !d.Done() {
+		t.Error("a program that failed to load can be stepped")
+	}
+}
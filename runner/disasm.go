@@ -0,0 +1,220 @@
+package runner
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/noonien/techon/lexer"
+	"github.com/noonien/techon/parser"
+)
+
+// Disassemble writes prog to w as one opcode per line, indenting the
+// bodies of functions, ifs and loops.
+func Disassemble(prog parser.Program, w io.Writer) error {
+	return disassemble(w, prog, 0)
+}
+
+func disassemble(w io.Writer, body []parser.Statement, depth int) error {
+	for _, st := range body {
+		err := disassembleStatement(w, st, depth)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func disassembleStatement(w io.Writer, st parser.Statement, depth int) error {
+	op := func(format string, args ...interface{}) error {
+		_, err := fmt.Fprintf(w, strings.Repeat("  ", depth)+format+"\n", args...)
+		return err
+	}
+
+	switch st := st.(type) {
+	case *parser.Comment:
+		return op("; %s", strings.Join(strings.Fields(st.Body), " "))
+
+	case *parser.DeclarationStatement:
+		return op("DECLARE %s %d", st.Name, st.Cells)
+
+	case *parser.FunctionStatement:
+		err := op("FUNC %s", st.Name)
+		if err != nil {
+			return err
+		}
+
+		err = disassemble(w, st.Body, depth+1)
+		if err != nil {
+			return err
+		}
+
+		return op("ENDFUNC")
+
+	case *parser.PushNumberStatement:
+		return op("PUSH %d", st.Number)
+
+	case *parser.PushFloatStatement:
+		return op("PUSH %s", Float(st.Number))
+
+	case *parser.IdentifierCallStatement:
+		return op("CALL %s", st.Identifier)
+
+	case *parser.TickStatement:
+		return op("TICK %s", st.Name)
+
+	case *parser.AliasStatement:
+		return op("ALIAS %s %s", st.Name, st.Target)
+
+	case *parser.EnumStatement:
+		return op("ENUM %s", strings.Join(st.Names, " "))
+
+	case *parser.DefinedStatement:
+		return op("DEFINED %s", st.Name)
+
+	case *parser.AbortStatement:
+		return op("ABORT %q", st.Message)
+
+	case *parser.ValueStatement:
+		return op("VALUE %s", st.Name)
+
+	case *parser.ToStatement:
+		return op("TO %s", st.Name)
+
+	case *parser.SeeStatement:
+		return op("SEE %s", st.Name)
+
+	case *parser.IfStatement:
+		err := op("IF")
+		if err != nil {
+			return err
+		}
+
+		err = disassemble(w, st.Body, depth+1)
+		if err != nil {
+			return err
+		}
+
+		if len(st.ElseBody) > 0 {
+			err = op("ELSE")
+			if err != nil {
+				return err
+			}
+
+			err = disassemble(w, st.ElseBody, depth+1)
+			if err != nil {
+				return err
+			}
+		}
+
+		return op("ENDIF")
+
+	case *parser.WhileStatement:
+		err := op("WHILE")
+		if err != nil {
+			return err
+		}
+
+		err = disassemble(w, st.Body, depth+1)
+		if err != nil {
+			return err
+		}
+
+		return op("REPEAT")
+
+	case *parser.TimeStatement:
+		err := op("TIME")
+		if err != nil {
+			return err
+		}
+
+		err = disassemble(w, st.Body, depth+1)
+		if err != nil {
+			return err
+		}
+
+		return op("ENDTIME")
+
+	case *parser.CaseStatement:
+		err := op("CASE")
+		if err != nil {
+			return err
+		}
+
+		for _, clause := range st.Cases {
+			err = op("OF %d", clause.Value)
+			if err != nil {
+				return err
+			}
+
+			err = disassemble(w, clause.Body, depth+1)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(st.Default) > 0 {
+			err = op("DEFAULT")
+			if err != nil {
+				return err
+			}
+
+			err = disassemble(w, st.Default, depth+1)
+			if err != nil {
+				return err
+			}
+		}
+
+		return op("ENDCASE")
+	}
+
+	return op("%s", opcode(st))
+}
+
+// opcode returns the opcode of a statement without operands. Statements
+// other than operators are named after their type.
+func opcode(st parser.Statement) string {
+	switch st := st.(type) {
+	case *parser.MathOperationStatement:
+		return opcodes[st.Op]
+
+	case parser.UnaryOperationStatement:
+		return opcodes[lexer.Token(st)]
+
+	case parser.CompareOperationStatement:
+		return opcodes[lexer.Token(st)]
+	}
+
+	return strings.ToUpper(strings.TrimSuffix(statementName(st), "Statement"))
+}
+
+// opcodes maps operator tokens to their disassembled opcode.
+var opcodes = map[lexer.Token]string{
+	lexer.Minus:    "SUB",
+	lexer.Plus:     "ADD",
+	lexer.Multiply: "MUL",
+	lexer.Divide:   "DIV",
+	lexer.Modulus:  "MOD",
+
+	lexer.OnePlus:     "INC",
+	lexer.OneMinus:    "DEC",
+	lexer.TwoPlus:     "ADD2",
+	lexer.TwoMinus:    "SUB2",
+	lexer.TwoMultiply: "MUL2",
+	lexer.TwoDivide:   "DIV2",
+
+	lexer.EQ:  "EQ",
+	lexer.NE:  "NE",
+	lexer.LT:  "LT",
+	lexer.GT:  "GT",
+	lexer.LTE: "LTE",
+	lexer.GTE: "GTE",
+}
+
+// statementName returns the type name of st without its package, e.g.
+// "DupStatement".
+func statementName(st parser.Statement) string {
+	name := fmt.Sprintf("%T", st)
+	return name[strings.LastIndex(name, ".")+1:]
+}
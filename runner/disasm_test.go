@@ -0,0 +1,62 @@
+package runner
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/noonien/techon/parser"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestDisassemble(t *testing.T) {
+	f, err := os.Open("testdata/disasm.to")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	prog, err := parser.NewParser(f).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err = Disassemble(prog, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const golden = "testdata/disasm.golden"
+	if *update {
+		err = os.WriteFile(golden, buf.Bytes(), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := buf.String(); got != string(want) {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSee(t *testing.T) {
+	got := outputOf(t, ": double ( n -- 2n ) 2 * ;\n: quad double double ;\nsee double see quad")
+	want := ": double ( n -- 2n ) 2 * ;\n: quad double double ;\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	var unresolved *UnresolvedIdentifierError
+	if err := run(t, NewMachine(), "see nope"); !errors.As(err, &unresolved) {
+		t.Errorf("got %v, want an UnresolvedIdentifierError", err)
+	}
+}
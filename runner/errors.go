@@ -0,0 +1,164 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/noonien/techon/lexer"
+)
+
+// ErrDivisionByZero is returned when dividing or taking the modulus by zero.
+var ErrDivisionByZero = errors.New("division by zero")
+
+// ErrOverflow is returned when the result of an operation does not fit in
+// an integer.
+var ErrOverflow = errors.New("integer overflow")
+
+// ErrNegativeSquareRoot is returned when taking the square root of a
+// negative number.
+var ErrNegativeSquareRoot = errors.New("square root of negative number")
+
+// ErrBufferFull is returned when printing more than fits in the buffer output
+// is redirected to.
+var ErrBufferFull = errors.New("output buffer full")
+
+// ErrLeaveOutsideLoop is returned when leave is used outside of a loop in
+// the same function.
+var ErrLeaveOutsideLoop = errors.New("leave outside of loop")
+
+// ErrExitOutsideFunction is returned when exit is used outside of a function.
+var ErrExitOutsideFunction = errors.New("exit outside of function")
+
+// ErrArityWithoutMark is returned by arity when there is no mark to compare
+// the stack depth to.
+var ErrArityWithoutMark = errors.New("arity without mark")
+
+// errQuit stops the program, unwinding through all loops and calls.
+var errQuit = errors.New("quit")
+
+// errLeave exits the innermost loop.
+var errLeave = errors.New("leave")
+
+// errExit returns from the function being executed, unwinding through its
+// loops.
+var errExit = errors.New("exit")
+
+// errTailCall is returned by a self-recursive call in tail position to
+// restart the function being executed.
+var errTailCall = errors.New("tail call")
+
+// StackUnderflowError is returned when an operation needs more items than
+// the stack currently holds.
+type StackUnderflowError struct {
+	Op   string
+	Need int
+	Have int
+
+	// Return is set if the items were needed on the return stack.
+	Return bool
+}
+
+func (e *StackUnderflowError) Error() string {
+	stack := "stack"
+	if e.Return {
+		stack = "return stack"
+	}
+
+	if e.Have == 0 && e.Need == 1 {
+		return "cannot perform " + e.Op + ", " + stack + " empty"
+	}
+
+	return fmt.Sprintf("cannot perform %s: %s has %d of %d required items", e.Op, stack, e.Have, e.Need)
+}
+
+// UnresolvedIdentifierError is returned when an identifier is neither a
+// variable nor a function.
+type UnresolvedIdentifierError struct {
+	Name string
+}
+
+func (e *UnresolvedIdentifierError) Error() string {
+	return "cannot resolve identifier \"" + e.Name + "\""
+}
+
+// AddressError is returned when an address does not belong to any variable.
+type AddressError struct {
+	Addr int
+}
+
+func (e *AddressError) Error() string {
+	return fmt.Sprintf("could not resolve address %d", e.Addr)
+}
+
+// RedeclarationError is returned when a variable or function is declared
+// with a name that is already in use.
+type RedeclarationError struct {
+	// Kind is what was being declared, "variable", "function",
+	// "constant", "value", "builtin" or "alias".
+	Kind string
+	Name string
+
+	// Existing is the kind of the declaration already using Name.
+	Existing string
+
+	// Pos is the position of the offending declaration, if known.
+	Pos lexer.Pos
+}
+
+func (e *RedeclarationError) Error() string {
+	name := "\"" + e.Name + "\""
+	if e.Pos.Line > 0 {
+		name += fmt.Sprintf(" at line %d", e.Pos.Line)
+	}
+
+	if e.Kind == e.Existing {
+		return "cannot redeclare " + e.Kind + " " + name
+	}
+
+	return "cannot declare " + e.Kind + " " + name + ", " + e.Existing + " already exists with that name"
+}
+
+// withContext wraps err with a description of the statement being executed
+// when it occurred. Control flow errors are returned unchanged so they can
+// still be compared directly.
+func withContext(err error, format string, args ...interface{}) error {
+	if err == nil || err == errQuit || err == errLeave || err == errExit || err == errTailCall {
+		return err
+	}
+
+	return fmt.Errorf(format+": %w", append(args, err)...)
+}
+
+// AbortError is returned by abort" when its flag is set, carrying the
+// message given to it.
+type AbortError struct {
+	Message string
+}
+
+func (e *AbortError) Error() string {
+	return e.Message
+}
+
+// ParseError is returned by Run when the program could not be parsed, to
+// tell it apart from errors raised while executing it.
+type ParseError struct {
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return "parse error: " + e.Err.Error()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// need returns a StackUnderflowError for op if the stack holds less than n
+// items.
+func (m *Machine) need(op string, n int) error {
+	if len(m.Stack) < n {
+		return &StackUnderflowError{Op: op, Need: n, Have: len(m.Stack)}
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrorTypes(t *testing.T) {
+	var underflow *StackUnderflowError
+	err := run(t, NewMachine(), "1 +")
+	if !errors.As(err, &underflow) {
+		t.Fatalf("got %v, want a StackUnderflowError", err)
+	}
+	if underflow.Op != "'+'" || underflow.Need != 2 || underflow.Have != 1 {
+		t.Errorf("got %+v, want Op '+' Need 2 Have 1", underflow)
+	}
+
+	var unresolved *UnresolvedIdentifierError
+	err = run(t, NewMachine(), "foo")
+	if !errors.As(err, &unresolved) || unresolved.Name != "foo" {
+		t.Errorf("got %v, want an UnresolvedIdentifierError for foo", err)
+	}
+
+	var addr *AddressError
+	err = run(t, NewMachine(), "variable x 7 @")
+	if !errors.As(err, &addr) || addr.Addr != 7 {
+		t.Errorf("got %v, want an AddressError for 7", err)
+	}
+
+	err = run(t, NewMachine(), "1 0 /")
+	if !errors.Is(err, ErrDivisionByZero) {
+		t.Errorf("got %v, want ErrDivisionByZero", err)
+	}
+}
+
+func TestRedeclarationError(t *testing.T) {
+	tests := []struct {
+		src      string
+		kind     string
+		existing string
+		line     int
+	}{
+		{"variable x\nvariable x", "variable", "variable", 2},
+		{"variable x\n\n: x 1 ;", "function", "variable", 3},
+		{": f 1 ;\nvariable f", "variable", "function", 2},
+	}
+
+	for _, tt := range tests {
+		var redecl *RedeclarationError
+		err := run(t, NewMachine(), tt.src)
+		if !errors.As(err, &redecl) {
+			t.Errorf("%q: got %v, want a RedeclarationError", tt.src, err)
+			continue
+		}
+
+		if redecl.Kind != tt.kind || redecl.Existing != tt.existing || redecl.Pos.Line != tt.line {
+			t.Errorf("%q: got %+v, want %s over %s at line %d", tt.src, redecl, tt.kind, tt.existing, tt.line)
+		}
+	}
+
+	err := run(t, NewMachine(), "variable x\nvariable x")
+	want := `cannot redeclare variable "x" at line 2`
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v, want %s", err, want)
+	}
+}
+
+func TestErrorContext(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{": f drop ; f", `in function "f": cannot perform drop, stack empty`},
+		{"1 if drop then", "in if: cannot perform drop, stack empty"},
+		{"0 if else drop then", "in else: cannot perform drop, stack empty"},
+		{": g 1 while drop drop repeat ; g", `in function "g": in while loop: cannot perform drop, stack empty`},
+	}
+
+	for _, tt := range tests {
+		err := run(t, NewMachine(), tt.src)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%q: got %v, want %s", tt.src, err, tt.want)
+		}
+	}
+
+	err := run(t, NewMachine(), ": f 1 0 / ; f")
+	if !errors.Is(err, ErrDivisionByZero) {
+		t.Errorf("wrapping lost the error: %v", err)
+	}
+}
+
+func TestOperatorUnderflowError(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"1 <", "cannot perform '<': stack has 1 of 2 required items"},
+		{"1 >=", "cannot perform '>=': stack has 1 of 2 required items"},
+		{"<>", "cannot perform '<>': stack has 0 of 2 required items"},
+		{"1 +", "cannot perform '+': stack has 1 of 2 required items at line 1, col 3"},
+		{"1 mod", "cannot perform mod: stack has 1 of 2 required items at line 1, col 3"},
+		{"1 2 2over", "cannot perform 2over: stack has 2 of 4 required items"},
+	}
+
+	for _, tt := range tests {
+		err := run(t, NewMachine(), tt.src)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%q: got %v, want %s", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestMathErrorPosition(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"5 0 /", "division by zero at line 1, col 5"},
+		{"1 2 +\n  5 0 mod", "division by zero at line 2, col 7"},
+		{": f 5 0 / ;\nf", `in function "f": division by zero at line 1, col 9`},
+	}
+
+	for _, tt := range tests {
+		err := run(t, NewMachine(), tt.src)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%q: got %v, want %s", tt.src, err, tt.want)
+		}
+		if !errors.Is(err, ErrDivisionByZero) {
+			t.Errorf("%q: got %v, want ErrDivisionByZero", tt.src, err)
+		}
+	}
+}
+
+func TestAbort(t *testing.T) {
+	m := NewMachine()
+	err := run(t, m, `1 2 0 abort" not reached" 3`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(m.Stack); got != "[1 2 3]" {
+		t.Errorf("got %s, want [1 2 3]", got)
+	}
+
+	m = NewMachine()
+	err = run(t, m, `: check 0 < abort" negative value" ; 1 check -1 check 2`)
+
+	var abort *AbortError
+	if !errors.As(err, &abort) || abort.Message != "negative value" {
+		t.Errorf("got %v, want an AbortError with the message", err)
+	}
+	if got := fmt.Sprint(m.Stack); got != "[]" {
+		t.Errorf("got %s after aborting, want []", got)
+	}
+
+	err = run(t, NewMachine(), `abort" empty"`)
+	if err == nil || errors.As(err, &abort) {
+		t.Errorf("got %v, want a stack underflow", err)
+	}
+}
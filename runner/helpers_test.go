@@ -0,0 +1,90 @@
+package runner
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/noonien/techon/parser"
+)
+
+// parse parses src, failing the test if it is not a valid program.
+func parse(t testing.TB, src string) parser.Program {
+	t.Helper()
+
+	prog, err := parser.NewParser(strings.NewReader(src)).Parse()
+	if err != nil {
+		t.Fatalf("parsing %q: %v", src, err)
+	}
+
+	return prog
+}
+
+// compile parses and compiles src, failing the test if it cannot be
+// compiled.
+func compile(t testing.TB, src string) *Compiled {
+	t.Helper()
+
+	code, err := Compile(parse(t, src))
+	if err != nil {
+		t.Fatalf("compiling %q: %v", src, err)
+	}
+
+	return code
+}
+
+// run parses src and executes it on m.
+func run(t *testing.T, m *Machine, src string) error {
+	t.Helper()
+	return m.Execute(parse(t, src))
+}
+
+// stackOf runs src on a new Machine, discarding its output, and returns its
+// final stack formatted as by fmt.Sprint.
+func stackOf(t *testing.T, src string) string {
+	t.Helper()
+
+	m := NewMachine()
+	m.SetOutput(io.Discard)
+	err := run(t, m, src)
+	if err != nil {
+		t.Fatalf("running %q: %v", src, err)
+	}
+
+	return fmt.Sprint(m.Stack)
+}
+
+// stackTest is a program together with the stack it should leave.
+type stackTest struct {
+	src  string
+	want string
+}
+
+// testStacks runs each test on a new Machine and compares the final stacks.
+func testStacks(t *testing.T, tests []stackTest) {
+	t.Helper()
+
+	for _, tt := range tests {
+		if got := stackOf(t, tt.src); got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+// outputOf runs src on a new Machine and returns what it printed.
+func outputOf(t *testing.T, src string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	m := NewMachine()
+	m.SetOutput(&buf)
+
+	err := run(t, m, src)
+	if err != nil {
+		t.Fatalf("running %q: %v", src, err)
+	}
+
+	return buf.String()
+}
@@ -0,0 +1,625 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/noonien/techon/parser"
+)
+
+// cells resolves count consecutive addresses starting at addr, failing if
+// any of them does not belong to a variable. With StrictMemory, addresses
+// taken from a variable must all lie within it.
+func (m *Machine) cells(addr Value, count int) ([]*int, error) {
+	if count < 0 {
+		return nil, fmt.Errorf("invalid cell count %d", count)
+	}
+
+	if count > 0 {
+		err := checkOwner(addr, addr.Int())
+		if err == nil {
+			err = checkOwner(addr, addr.Int()+count-1)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// resolve a variable at a time, so that a count larger than the memory
+	// in use fails before it is allocated for
+	var ptrs []*int
+	for next := addr.Int(); len(ptrs) < count; {
+		v, idx, err := m.resolveVariable(next)
+		if err != nil {
+			return nil, err
+		}
+
+		for ; idx < v.Size && len(ptrs) < count; idx++ {
+			ptrs = append(ptrs, &v.Data[idx])
+			next++
+		}
+	}
+
+	return ptrs, nil
+}
+
+// fill stores a value in count cells starting at addr: addr count value fill.
+func (m *Machine) fill(st *parser.FillStatement) error {
+	vals, err := m.pop("fill", 3)
+	if err != nil {
+		return err
+	}
+
+	ptrs, err := m.cells(vals[0], vals[1].Int())
+	if err != nil {
+		return err
+	}
+
+	for _, ptr := range ptrs {
+		*ptr = vals[2].Int()
+	}
+
+	return nil
+}
+
+// move copies count cells from src to dst: src dst count move. Overlapping
+// ranges are copied as if through an intermediate buffer.
+func (m *Machine) move(st *parser.MoveStatement) error {
+	vals, err := m.pop("move", 3)
+	if err != nil {
+		return err
+	}
+
+	src, err := m.cells(vals[0], vals[2].Int())
+	if err != nil {
+		return err
+	}
+
+	dst, err := m.cells(vals[1], vals[2].Int())
+	if err != nil {
+		return err
+	}
+
+	// copy backwards when moving up so cells are read before overwritten
+	if vals[1].Int() > vals[0].Int() {
+		for i := len(src) - 1; i >= 0; i-- {
+			*dst[i] = *src[i]
+		}
+	} else {
+		for i := range src {
+			*dst[i] = *src[i]
+		}
+	}
+
+	return nil
+}
+
+// size replaces an address with the number of cells of the variable it
+// belongs to.
+func (m *Machine) size(st *parser.SizeStatement) error {
+	err := m.need("size", 1)
+	if err != nil {
+		return err
+	}
+
+	v, _, err := m.resolveVariable(m.Stack[len(m.Stack)-1].Int())
+	if err != nil {
+		return err
+	}
+
+	m.Stack[len(m.Stack)-1] = Int(v.Size)
+	return nil
+}
+
+// dump prints count cells starting at addr, one "address: value" pair per
+// line: addr count dump.
+func (m *Machine) dump(st *parser.DumpStatement) error {
+	vals, err := m.pop("dump", 2)
+	if err != nil {
+		return err
+	}
+
+	ptrs, err := m.cells(vals[0], vals[1].Int())
+	if err != nil {
+		return err
+	}
+
+	for i, ptr := range ptrs {
+		str, err := m.format(Int(*ptr))
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(m.out, "%d: %s\n", vals[0].Int()+i, str)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cellPlus offsets an address by a number of cells, failing if the result
+// falls outside the variable the address belongs to: addr n cell+.
+func (m *Machine) cellPlus(st *parser.CellPlusStatement) error {
+	args, err := m.popInts("cell+", 2)
+	if err != nil {
+		return err
+	}
+
+	v, _, err := m.resolveVariable(args[0])
+	if err != nil {
+		return err
+	}
+
+	addr := args[0] + args[1]
+	if addr < v.Addr || addr >= v.Addr+v.Size {
+		return fmt.Errorf("address %d is outside of variable %q", addr, v.Name)
+	}
+
+	m.Stack = append(m.Stack, m.address(addr))
+	return nil
+}
+
+// read reads up to max bytes of input into consecutive cells starting at
+// addr, one byte per cell, and pushes the number of bytes read:
+// addr max read.
+func (m *Machine) read(st *parser.ReadStatement) error {
+	vals, err := m.pop("read", 2)
+	if err != nil {
+		return err
+	}
+
+	ptrs, err := m.cells(vals[0], vals[1].Int())
+	if err != nil {
+		return err
+	}
+
+	if m.in == nil {
+		m.Stack = append(m.Stack, Int(0))
+		return nil
+	}
+
+	buf := make([]byte, len(ptrs))
+	n, err := io.ReadFull(m.in, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return err
+	}
+
+	for i, b := range buf[:n] {
+		*ptrs[i] = int(b)
+	}
+
+	m.Stack = append(m.Stack, Int(n))
+	return nil
+}
+
+// hash pushes the 32-bit FNV-1a hash of count cells starting at addr, taking
+// the low byte of each cell: addr count hash. Like other results, the hash
+// wraps around at IntBits bits.
+func (m *Machine) hash(st *parser.HashStatement) error {
+	vals, err := m.pop("hash", 2)
+	if err != nil {
+		return err
+	}
+
+	ptrs, err := m.cells(vals[0], vals[1].Int())
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, len(ptrs))
+	for i, ptr := range ptrs {
+		buf[i] = byte(*ptr)
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write(buf)
+
+	m.Stack = append(m.Stack, Int(m.wrap(int(h.Sum32()))))
+	return nil
+}
+
+// erase sets count cells starting at addr to zero: addr count erase.
+func (m *Machine) erase(st *parser.EraseStatement) error {
+	vals, err := m.pop("erase", 2)
+	if err != nil {
+		return err
+	}
+
+	ptrs, err := m.cells(vals[0], vals[1].Int())
+	if err != nil {
+		return err
+	}
+
+	for _, ptr := range ptrs {
+		*ptr = 0
+	}
+
+	return nil
+}
+
+// compareMem pushes 1 if the count cells starting at addr1 and addr2 hold
+// the same values, 0 otherwise: addr1 addr2 count compare-mem.
+func (m *Machine) compareMem(st *parser.CompareMemStatement) error {
+	vals, err := m.pop("compare-mem", 3)
+	if err != nil {
+		return err
+	}
+
+	a, err := m.cells(vals[0], vals[2].Int())
+	if err != nil {
+		return err
+	}
+
+	b, err := m.cells(vals[1], vals[2].Int())
+	if err != nil {
+		return err
+	}
+
+	equal := 1
+	for i := range a {
+		if *a[i] != *b[i] {
+			equal = 0
+			break
+		}
+	}
+
+	m.Stack = append(m.Stack, Int(equal))
+	return nil
+}
+
+// cellWriter is an io.Writer storing each byte written in the next of a range
+// of cells.
+type cellWriter struct {
+	ptrs []*int
+	n    int
+
+	// prev is the output to restore once done.
+	prev io.Writer
+}
+
+func (w *cellWriter) Write(p []byte) (int, error) {
+	for i, b := range p {
+		if w.n == len(w.ptrs) {
+			return i, ErrBufferFull
+		}
+
+		*w.ptrs[w.n] = int(b)
+		w.n++
+	}
+
+	return len(p), nil
+}
+
+// toBuffer redirects the output to count cells starting at addr, one byte
+// per cell, until buffer>: addr count >buffer.
+func (m *Machine) toBuffer(st *parser.ToBufferStatement) error {
+	if m.buffer != nil {
+		return errors.New("output is already redirected to a buffer")
+	}
+
+	vals, err := m.pop(">buffer", 2)
+	if err != nil {
+		return err
+	}
+
+	ptrs, err := m.cells(vals[0], vals[1].Int())
+	if err != nil {
+		return err
+	}
+
+	m.buffer = &cellWriter{ptrs: ptrs, prev: m.out}
+	m.out = m.buffer
+	return nil
+}
+
+// fromBuffer restores the output redirected by >buffer and pushes the number
+// of bytes written to the buffer.
+func (m *Machine) fromBuffer(st *parser.FromBufferStatement) error {
+	if m.buffer == nil {
+		return errors.New("output is not redirected to a buffer")
+	}
+
+	m.Stack = append(m.Stack, Int(m.buffer.n))
+	m.restoreOutput()
+	return nil
+}
+
+// restoreOutput ends the redirection started by >buffer, if any.
+func (m *Machine) restoreOutput() {
+	if m.buffer == nil {
+		return
+	}
+
+	m.out = m.buffer.prev
+	m.buffer = nil
+}
+
+// sort sorts count cells starting at addr in ascending order: addr count sort.
+func (m *Machine) sort(st *parser.SortStatement) error {
+	vals, err := m.pop("sort", 2)
+	if err != nil {
+		return err
+	}
+
+	ptrs, err := m.cells(vals[0], vals[1].Int())
+	if err != nil {
+		return err
+	}
+
+	sorted := make([]int, len(ptrs))
+	for i, ptr := range ptrs {
+		sorted[i] = *ptr
+	}
+	sort.Ints(sorted)
+
+	for i, ptr := range ptrs {
+		*ptr = sorted[i]
+	}
+
+	return nil
+}
+
+// find pushes the address of the first of count cells starting at addr that
+// holds value, or -1 if none does: addr count value find.
+func (m *Machine) find(st *parser.FindStatement) error {
+	vals, err := m.pop("find", 3)
+	if err != nil {
+		return err
+	}
+
+	ptrs, err := m.cells(vals[0], vals[1].Int())
+	if err != nil {
+		return err
+	}
+
+	found := -1
+	for i, ptr := range ptrs {
+		if *ptr == vals[2].Int() {
+			found = vals[0].Int() + i
+			break
+		}
+	}
+
+	m.Stack = append(m.Stack, Int(found))
+	return nil
+}
+
+// getch reads one rune of input and pushes its code point, or -1 at the end
+// of the input.
+func (m *Machine) getch(st *parser.GetchStatement) error {
+	if m.in == nil {
+		m.Stack = append(m.Stack, Int(-1))
+		return nil
+	}
+
+	r, _, err := m.in.ReadRune()
+	if errors.Is(err, io.EOF) {
+		m.Stack = append(m.Stack, Int(-1))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	m.Stack = append(m.Stack, Int(int(r)))
+	return nil
+}
+
+// _type prints count cells starting at addr as characters, one code point
+// per cell: addr count type.
+func (m *Machine) _type(st *parser.TypeStatement) error {
+	vals, err := m.pop("type", 2)
+	if err != nil {
+		return err
+	}
+
+	ptrs, err := m.cells(vals[0], vals[1].Int())
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	for _, ptr := range ptrs {
+		sb.WriteRune(rune(*ptr))
+	}
+
+	_, err = io.WriteString(m.out, sb.String())
+	return err
+}
+
+// byteGet pushes a byte of the cell at addr, bytes being numbered from the
+// least significant one: addr index byte@.
+func (m *Machine) byteGet(st *parser.ByteGetStatement) error {
+	args, err := m.pop("byte@", 2)
+	if err != nil {
+		return err
+	}
+
+	shift, err := m.byteShift("byte@", args[1].Int())
+	if err != nil {
+		return err
+	}
+
+	ptr, err := m.deref(args[0])
+	if err != nil {
+		return err
+	}
+
+	m.Stack = append(m.Stack, Int(*ptr>>shift&0xff))
+	return nil
+}
+
+// byteStore sets a byte of the cell at addr to the low byte of val, leaving
+// the other bytes unchanged: val addr index byte!.
+func (m *Machine) byteStore(st *parser.ByteStoreStatement) error {
+	args, err := m.pop("byte!", 3)
+	if err != nil {
+		return err
+	}
+
+	shift, err := m.byteShift("byte!", args[2].Int())
+	if err != nil {
+		return err
+	}
+
+	ptr, err := m.deref(args[1])
+	if err != nil {
+		return err
+	}
+
+	*ptr = m.wrap(*ptr&^(0xff<<shift) | (args[0].Int()&0xff)<<shift)
+	return nil
+}
+
+// cFetch pushes the byte at a byte address, see byteAddr: baddr c@.
+func (m *Machine) cFetch(st *parser.CFetchStatement) error {
+	args, err := m.pop("c@", 1)
+	if err != nil {
+		return err
+	}
+
+	addr, index, err := m.byteAddr("c@", args[0].Int())
+	if err != nil {
+		return err
+	}
+
+	err = checkOwner(args[0], addr)
+	if err != nil {
+		return err
+	}
+
+	ptr, err := m.resolveAddr(addr)
+	if err != nil {
+		return err
+	}
+
+	m.Stack = append(m.Stack, Int(*ptr>>(index*8)&0xff))
+	return nil
+}
+
+// cStore sets the byte at a byte address to the low byte of val:
+// val baddr c!.
+func (m *Machine) cStore(st *parser.CStoreStatement) error {
+	args, err := m.pop("c!", 2)
+	if err != nil {
+		return err
+	}
+
+	addr, index, err := m.byteAddr("c!", args[1].Int())
+	if err != nil {
+		return err
+	}
+
+	err = checkOwner(args[1], addr)
+	if err != nil {
+		return err
+	}
+
+	ptr, err := m.resolveAddr(addr)
+	if err != nil {
+		return err
+	}
+
+	shift := index * 8
+	*ptr = m.wrap(*ptr&^(0xff<<shift) | (args[0].Int()&0xff)<<shift)
+	return nil
+}
+
+// byteShift returns the shift selecting byte index of a cell, failing if the
+// cell has no such byte.
+func (m *Machine) byteShift(op string, index int) (int, error) {
+	n, err := m.cellBytes(op)
+	if err != nil {
+		return 0, err
+	}
+
+	if index < 0 || index >= n {
+		return 0, fmt.Errorf("cannot perform %s, byte index %d is out of range", op, index)
+	}
+
+	return index * 8, nil
+}
+
+// cellBytes returns the number of whole bytes in a cell, failing if cells
+// are narrower than a byte.
+func (m *Machine) cellBytes(op string) (int, error) {
+	bits := m.IntBits
+	if bits <= 0 || bits > 64 {
+		bits = 64
+	}
+
+	if bits < 8 {
+		return 0, fmt.Errorf("cannot perform %s, cells of %d bits do not hold a byte", op, bits)
+	}
+
+	return bits / 8, nil
+}
+
+// byteAddr splits a byte address into the address of the cell holding the
+// byte and the index of the byte within the cell. Byte address b is byte
+// b % n of cell b / n, where n is the number of bytes in a cell.
+func (m *Machine) byteAddr(op string, baddr int) (addr, index int, err error) {
+	if baddr < 0 {
+		return 0, 0, &AddressError{Addr: baddr}
+	}
+
+	n, err := m.cellBytes(op)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return baddr / n, baddr % n, nil
+}
+
+// allot pops n and reserves a region of n cells after all allocated
+// variables, pushing its address. Regions have no name and, unlike variables
+// declared inside functions, are never freed.
+func (m *Machine) allot(st *parser.AllotStatement) error {
+	args, err := m.popInts("allot", 1)
+	if err != nil {
+		return err
+	}
+
+	n := args[0]
+	if n <= 0 {
+		return fmt.Errorf("cannot allot %d cells", n)
+	}
+
+	if m.MaxVariableCells > 0 && n > m.MaxVariableCells {
+		return fmt.Errorf("cannot allot %d cells, the limit is %d", n, m.MaxVariableCells)
+	}
+
+	if m.MaxTotalCells > 0 {
+		total := n
+		for _, v := range m.Variables {
+			total += v.Size
+		}
+
+		if total > m.MaxTotalCells {
+			return fmt.Errorf("cannot allot %d cells, variables would use %d cells, the limit is %d", n, total, m.MaxTotalCells)
+		}
+	}
+
+	v := m.allocate("", n)
+	m.Stack = append(m.Stack, m.address(v.Addr))
+	return nil
+}
+
+// here pushes the address following the last allocated cell, where the next
+// variable or allotted region starts unless StrictMemory is set.
+func (m *Machine) here(st *parser.HereStatement) error {
+	addr := 0
+	if len(m.Variables) > 0 {
+		last := m.Variables[len(m.Variables)-1]
+		addr = last.Addr + last.Size
+	}
+
+	m.Stack = append(m.Stack, Int(addr))
+	return nil
+}
@@ -0,0 +1,536 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"testing"
+
+	"github.com/noonien/techon/parser"
+)
+
+func TestStrictMemory(t *testing.T) {
+	const decls = "variable x 5 cells variable y 3 cells 42 y ! "
+
+	tests := []struct {
+		src     string
+		wantErr bool
+	}{
+		{"x 4 + @", false},
+		{"x 1+ 2+ @", false},
+		{"x 5 + @", true},
+		{"x 1048576 + @", true},
+		{"7 x 5 + !", true},
+		{"x 1- @", true},
+		{"x 4 + 1+ @", true},
+		{"x 2 0 fill", false},
+		{"x 3 3 0 fill", true},
+		{"x 1 cell+ 5 + @", true},
+		{"2 allot 2 + @", true},
+		{"x 4 + 0 byte@", false},
+		{"x 1048576 + 0 byte@", true},
+		{"1 x 4 + 0 byte!", false},
+		{"1 x 1048576 + 0 byte!", true},
+	}
+
+	for _, tt := range tests {
+		m := NewMachine()
+		m.StrictMemory = true
+
+		err := run(t, m, decls+tt.src)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: got error %v, want error %v", tt.src, err, tt.wantErr)
+		}
+	}
+}
+
+func TestStrictMemoryDisabled(t *testing.T) {
+	got := stackOf(t, "variable x 5 cells variable y 3 cells 42 y ! x 5 + @")
+	if got != "[42]" {
+		t.Errorf("got %s, want [42]", got)
+	}
+}
+
+func TestStrictMemoryAddressArithmetic(t *testing.T) {
+	// the difference of two addresses is a plain number
+	m := NewMachine()
+	m.StrictMemory = true
+
+	err := run(t, m, "variable x 5 cells x 3 + x - 100 +")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := fmt.Sprint(m.Stack); got != "[103]" {
+		t.Errorf("got %s, want [103]", got)
+	}
+}
+
+func TestFill(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"variable a 3 cells a 3 7 fill a @ a 2 + @", "[7 7]"},
+		{"variable a variable b a 2 7 fill a @ b @", "[7 7]"},
+		{"variable a 5 a ! a 0 7 fill a @", "[5]"},
+	})
+
+	for _, src := range []string{
+		"variable a a -1 7 fill",
+		"variable a a 2 7 fill",
+		"variable a a 1000000000000000000 1 fill",
+	} {
+		if err := run(t, NewMachine(), src); err == nil {
+			t.Errorf("%q: got no error", src)
+		}
+	}
+}
+
+func TestHugeCellCounts(t *testing.T) {
+	// none of these may try to allocate for the count before checking it
+	const huge = " 1000000000000000000 "
+	for _, src := range []string{
+		"a a" + huge + "compare-mem",
+		"a" + huge + ">buffer",
+		"a" + huge + "sort",
+		"a" + huge + "5 find",
+		"a" + huge + "type",
+		"a" + huge + "dump",
+		"a a" + huge + "move",
+	} {
+		err := run(t, NewMachine(), "variable a "+src)
+		if err == nil {
+			t.Errorf("%q: got no error", src)
+		}
+	}
+}
+
+func TestMove(t *testing.T) {
+	const decls = "variable a 4 cells 1 a ! 2 a 1+ ! 3 a 2 + ! "
+	testStacks(t, []stackTest{
+		{decls + "a a 2 + 2 move a 2 + @ a 3 + @", "[1 2]"},
+		{decls + "a a 1+ 3 move a @ a 1+ @ a 2 + @ a 3 + @", "[1 1 2 3]"},
+		{decls + "a 1+ a 3 move a @ a 1+ @ a 2 + @ a 3 + @", "[2 3 0 0]"},
+		{decls + "a a 2 + 0 move a 2 + @", "[3]"},
+	})
+
+	if err := run(t, NewMachine(), "variable a 2 cells a a 1+ 2 move"); err == nil {
+		t.Error("moving past the end of memory did not fail")
+	}
+}
+
+func TestSize(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"variable a 3 cells variable b a size b size", "[3 1]"},
+		{"variable a 3 cells a 2 + size", "[3]"},
+	})
+
+	var addrErr *AddressError
+	err := run(t, NewMachine(), "5 size")
+	if !errors.As(err, &addrErr) {
+		t.Errorf("got %v, want an AddressError", err)
+	}
+}
+
+func TestDump(t *testing.T) {
+	got := outputOf(t, "variable a 3 cells 5 a ! 255 a 2 + ! hex a 3 dump")
+	want := "0: 5\n1: 0\n2: ff\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if got := outputOf(t, "variable a a 0 dump"); got != "" {
+		t.Errorf("dumping no cells printed %q", got)
+	}
+}
+
+func TestVariableLimits(t *testing.T) {
+	err := run(t, NewMachine(), "variable a 999999999 cells")
+	if err == nil {
+		t.Error("declaring a variable above the default limit did not fail")
+	}
+
+	m := NewMachine()
+	m.MaxVariableCells = 4
+	if err := run(t, m, "variable a 4 cells"); err != nil {
+		t.Errorf("declaring a variable at the limit failed: %v", err)
+	}
+	if err := run(t, m, "variable b 5 cells"); err == nil {
+		t.Error("declaring a variable above the limit did not fail")
+	}
+
+	m = NewMachine()
+	m.MaxVariableCells = 0
+	if err := run(t, m, "variable a 20000000 cells"); err != nil {
+		t.Errorf("declaring a large variable without a limit failed: %v", err)
+	}
+
+	for _, src := range []string{"variable a -1 cells", "variable a 0 cells", "variable a 99999999999999999999 cells"} {
+		_, err := parser.NewParser(strings.NewReader(src)).Parse()
+		if err == nil {
+			t.Errorf("%q: parsed without error", src)
+		}
+	}
+}
+
+func TestMaxTotalCells(t *testing.T) {
+	m := NewMachine()
+	m.MaxTotalCells = 10
+	if err := run(t, m, "variable a 4 cells variable b 5 cells variable c"); err != nil {
+		t.Errorf("declaring variables up to the limit failed: %v", err)
+	}
+
+	err := run(t, m, "variable d")
+	want := `cannot declare variable "d", variables would use 11 cells, the limit is 10`
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v, want %s", err, want)
+	}
+
+	m = NewMachine()
+	m.MaxTotalCells = 0
+	if err := run(t, m, "variable a 1000 cells variable b 1000 cells"); err != nil {
+		t.Errorf("declaring variables without a limit failed: %v", err)
+	}
+}
+
+func TestAllot(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"3 allot 2 allot swap -", "[3]"},
+		{"3 allot dup 5 swap ! 2 allot dup 7 swap ! swap @ swap @", "[5 7]"},
+		{"variable a 2 allot a -", "[1]"},
+		{"2 allot dup 1+ 9 swap ! 1+ @", "[9]"},
+	})
+
+	for _, src := range []string{"0 allot", "-1 allot", "2 allot 2 + @"} {
+		m := NewMachine()
+		m.StrictMemory = true
+		if err := run(t, m, src); err == nil {
+			t.Errorf("%q: got no error", src)
+		}
+	}
+
+	m := NewMachine()
+	m.MaxTotalCells = 5
+	if err := run(t, m, "variable a 2 cells 3 allot drop"); err != nil {
+		t.Errorf("allotting up to the limit failed: %v", err)
+	}
+
+	err := run(t, m, "1 allot")
+	want := "cannot allot 1 cells, variables would use 6 cells, the limit is 5"
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v, want %s", err, want)
+	}
+}
+
+func TestCellPlus(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"variable a 3 cells 7 a 2 cell+ ! a 2 + @", "[7]"},
+		{"variable a 3 cells a 2 cell+ -2 cell+ a -", "[0]"},
+		{"variable x variable a 3 cells a 0 cell+", "[1]"},
+	})
+
+	for _, src := range []string{
+		"variable a 3 cells a 3 cell+",
+		"variable a 3 cells variable b a 3 cell+",
+		"variable x variable a 3 cells a -1 cell+",
+		"5 1 cell+",
+	} {
+		if err := run(t, NewMachine(), src); err == nil {
+			t.Errorf("%q: got no error", src)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	tests := []stackTest{
+		{"variable buf 10 cells buf 10 read buf @ buf 1+ @ buf 2 + @ buf 3 + @", "[3 104 105 10 0]"},
+		{"variable buf 2 cells buf 2 read buf 1+ @", "[2 105]"},
+		{"variable buf 2 cells buf 2 read drop buf 2 read buf @", "[1 10]"},
+	}
+
+	for _, tt := range tests {
+		m := NewMachine()
+		m.SetInput(strings.NewReader("hi\n"))
+
+		err := run(t, m, tt.src)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.src, err)
+		}
+
+		if got := fmt.Sprint(m.Stack); got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.src, got, tt.want)
+		}
+	}
+
+	if got := stackOf(t, "variable buf buf 1 read"); got != "[0]" {
+		t.Errorf("reading without input: got %s, want [0]", got)
+	}
+}
+
+func TestHash(t *testing.T) {
+	h := fnv.New32a()
+	h.Write([]byte("hi"))
+	want := fmt.Sprintf("[%d]", h.Sum32())
+
+	const decls = "variable a 2 cells variable b 2 cells 104 a ! 105 a 1+ ! "
+	testStacks(t, []stackTest{
+		{decls + "a 2 hash", want},
+		{decls + "360 b ! 105 b 1+ ! b 2 hash", want},
+		{decls + "a 2 hash b 2 hash =", "[0]"},
+		{decls + "a 0 hash a 0 hash =", "[1]"},
+	})
+}
+
+func TestErase(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"variable a 3 cells a 3 7 fill a 3 erase a @ a 1+ @ a 2 + @", "[0 0 0]"},
+		{"variable a 3 cells a 3 7 fill a 1+ 1 erase a @ a 1+ @ a 2 + @", "[7 0 7]"},
+	})
+
+	for _, src := range []string{
+		"variable a a 2 erase",
+		"variable a a -1 erase",
+	} {
+		if err := run(t, NewMachine(), src); err == nil {
+			t.Errorf("%q: got no error", src)
+		}
+	}
+}
+
+func TestCompareMem(t *testing.T) {
+	const decls = "variable a 3 cells variable b 3 cells a 3 7 fill b 3 7 fill "
+	testStacks(t, []stackTest{
+		{decls + "a b 3 compare-mem", "[1]"},
+		{decls + "5 b 2 + ! a b 3 compare-mem", "[0]"},
+		{decls + "5 b 2 + ! a b 2 compare-mem", "[1]"},
+		{decls + "a b 0 compare-mem", "[1]"},
+	})
+
+	for _, src := range []string{
+		"variable a 2 cells variable b a b 2 compare-mem",
+		"variable a 2 cells a a -1 compare-mem",
+	} {
+		if err := run(t, NewMachine(), src); err == nil {
+			t.Errorf("%q: got no error", src)
+		}
+	}
+}
+
+func TestBuffer(t *testing.T) {
+	var out strings.Builder
+	m := NewMachine()
+	m.SetOutput(&out)
+
+	err := run(t, m, "variable b 8 cells b 8 >buffer 42 . 7 . buffer> b @ b 1+ @ b 2 + @ b 3 + @ b 4 + @ 1 .")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := fmt.Sprint(m.Stack); got != "[5 52 50 32 55 32]" {
+		t.Errorf("got %s, want [5 52 50 32 55 32]", got)
+	}
+	if out.String() != "1 " {
+		t.Errorf("printed %q after buffer>, want %q", out.String(), "1 ")
+	}
+
+	for _, src := range []string{
+		"buffer>",
+		"variable b b 1 >buffer b 1 >buffer",
+		"variable b b 2 >buffer",
+	} {
+		if err := run(t, NewMachine(), src); err == nil {
+			t.Errorf("%q: got no error", src)
+		}
+	}
+
+	err = run(t, NewMachine(), "variable b 2 cells b 2 >buffer 123 .")
+	if !errors.Is(err, ErrBufferFull) {
+		t.Errorf("got %v, want ErrBufferFull", err)
+	}
+
+	// an error before buffer> restores the output
+	out.Reset()
+	m = NewMachine()
+	m.SetOutput(&out)
+
+	err = run(t, m, "variable b 2 cells b 2 >buffer 1 0 /")
+	if !errors.Is(err, ErrDivisionByZero) {
+		t.Fatalf("got %v, want ErrDivisionByZero", err)
+	}
+
+	if err := run(t, m, "7 . variable c c 1 >buffer buffer> drop"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "7 " {
+		t.Errorf("printed %q after the error, want %q", out.String(), "7 ")
+	}
+}
+
+func TestSort(t *testing.T) {
+	const decls = "variable a 4 cells 3 a ! 1 a 1+ ! 4 a 2 + ! -2 a 3 + ! "
+	testStacks(t, []stackTest{
+		{decls + "a 4 sort a @ a 1+ @ a 2 + @ a 3 + @", "[-2 1 3 4]"},
+		{decls + "a 1+ 2 sort a @ a 1+ @ a 2 + @ a 3 + @", "[3 1 4 -2]"},
+		{decls + "a 0 sort a @", "[3]"},
+	})
+
+	for _, src := range []string{
+		"variable a 2 cells a 3 sort",
+		"variable a a -1 sort",
+	} {
+		if err := run(t, NewMachine(), src); err == nil {
+			t.Errorf("%q: got no error", src)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	const decls = "variable a 4 cells 3 a ! 1 a 1+ ! 4 a 2 + ! 1 a 3 + ! "
+	testStacks(t, []stackTest{
+		{decls + "a 4 4 find a -", "[2]"},
+		{decls + "a 4 1 find a -", "[1]"},
+		{decls + "a 4 9 find", "[-1]"},
+		{decls + "a 0 3 find", "[-1]"},
+	})
+
+	for _, src := range []string{
+		"variable a 2 cells a 3 7 find",
+		"variable a a -1 7 find",
+	} {
+		if err := run(t, NewMachine(), src); err == nil {
+			t.Errorf("%q: got no error", src)
+		}
+	}
+}
+
+func TestType(t *testing.T) {
+	const decls = "variable s 3 cells 72 s ! 105 s 1+ ! 233 s 2 + ! "
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{decls + "s 2 type", "Hi"},
+		{decls + "s 3 type", "Hié"},
+		{decls + "s 1+ 1 type", "i"},
+		{decls + "s 0 type", ""},
+	}
+
+	for _, tt := range tests {
+		if got := outputOf(t, tt.src); got != tt.want {
+			t.Errorf("%q: printed %q, want %q", tt.src, got, tt.want)
+		}
+	}
+
+	if err := run(t, NewMachine(), "variable s s 2 type"); err == nil {
+		t.Error("typing past the end of memory did not fail")
+	}
+}
+
+func TestBytes(t *testing.T) {
+	const decls = "variable x 258 x ! "
+	testStacks(t, []stackTest{
+		{decls + "x 0 byte@ x 1 byte@ x 2 byte@", "[2 1 0]"},
+		{decls + "255 x 2 byte! x @", "[16711938]"},
+		{decls + "1 x 0 byte! x @", "[257]"},
+		{decls + "511 x 3 byte! x 3 byte@ x 0 byte@", "[255 2]"},
+		{"variable x -1 x ! x 7 byte@", "[255]"},
+	})
+
+	m := NewMachine()
+	m.IntBits = 16
+	if err := run(t, m, "variable x 128 x 1 byte! x @"); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(m.Stack); got != "[-32768]" {
+		t.Errorf("with 16 bits: got %s, want [-32768]", got)
+	}
+
+	for _, src := range []string{
+		"variable x x 8 byte@",
+		"variable x x -1 byte@",
+		"variable x 1 x 8 byte!",
+		"5 0 byte@",
+	} {
+		if err := run(t, NewMachine(), src); err == nil {
+			t.Errorf("%q: got no error", src)
+		}
+	}
+
+	m = NewMachine()
+	m.IntBits = 16
+	if err := run(t, m, "variable x x 2 byte@"); err == nil {
+		t.Error("reading byte 2 of a 16 bit cell did not fail")
+	}
+}
+
+func TestHere(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"here 3 allot drop here swap -", "[3]"},
+		{"here 3 allot -", "[0]"},
+		{"variable a 4 cells here a -", "[4]"},
+		{"variable a 2 cells here 2 allot = a 2 + here 2 - =", "[1 1]"},
+	})
+}
+
+func TestCFetchStore(t *testing.T) {
+	tests := []struct {
+		bits int
+		src  string
+		want string
+	}{
+		{64, "variable a 1 a 8 * c! 2 a 8 * 1+ c! a @ a 8 * c@ a 8 * 1+ c@", "[513 1 2]"},
+		{64, "variable a 300 a 8 * c! a @", "[44]"},
+		// bytes 7 and 8 are the last byte of a and the first byte of the
+		// cell after it
+		{64, "variable a 2 cells 65 a 8 * 7 + c! 66 a 8 * 8 + c! a @ a 1+ @ a 8 * 7 + c@ a 8 * 8 + c@", "[4683743612465315840 66 65 66]"},
+		{16, "variable a 2 cells 1 a 2 * 1+ c! 2 a 2 * 2 + c! a @ a 1+ @", "[256 2]"},
+		{8, "variable a 2 cells 200 a 1+ c! a 1+ @ a 1+ c@", "[-56 200]"},
+	}
+
+	for _, tt := range tests {
+		m := NewMachine()
+		m.IntBits = tt.bits
+
+		if err := run(t, m, tt.src); err != nil {
+			t.Errorf("%q with %d bits: %v", tt.src, tt.bits, err)
+			continue
+		}
+		if got := fmt.Sprint(m.Stack); got != tt.want {
+			t.Errorf("%q with %d bits: got %s, want %s", tt.src, tt.bits, got, tt.want)
+		}
+	}
+
+	// byte addresses derived from a variable are checked against it under
+	// StrictMemory; byte 8388608 lies in the first cell of y
+	for _, tt := range []struct {
+		src     string
+		wantErr bool
+	}{
+		{"x c@", false},
+		{"x 8388608 + c@", true},
+		{"1 x c!", false},
+		{"1 x 8388608 + c!", true},
+	} {
+		m := NewMachine()
+		m.StrictMemory = true
+
+		err := run(t, m, "variable x 5 cells variable y 3 cells "+tt.src)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: got error %v, want error %v", tt.src, err, tt.wantErr)
+		}
+	}
+
+	var addrErr *AddressError
+	if err := run(t, NewMachine(), "-1 c@"); !errors.As(err, &addrErr) {
+		t.Errorf("got %v, want an AddressError", err)
+	}
+
+	for _, src := range []string{"variable a a c@", "variable a 1 a c!", "variable a a 0 byte@"} {
+		m := NewMachine()
+		m.IntBits = 4
+
+		err := run(t, m, src)
+		if err == nil || !strings.Contains(err.Error(), "cells of 4 bits do not hold a byte") {
+			t.Errorf("%q with 4 bits: got %v, want an error", src, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package runner
+
+import "github.com/noonien/techon/parser"
+
+// needReturn returns a StackUnderflowError for op if the return stack holds
+// less than n items.
+func (m *Machine) needReturn(op string, n int) error {
+	if len(m.rstack) < n {
+		return &StackUnderflowError{Op: op, Need: n, Have: len(m.rstack), Return: true}
+	}
+
+	return nil
+}
+
+// toReturn moves the top n items of the stack to the return stack, keeping
+// their order.
+func (m *Machine) toReturn(op string, n int) error {
+	err := m.need(op, n)
+	if err != nil {
+		return err
+	}
+
+	m.rstack = append(m.rstack, m.Stack[len(m.Stack)-n:]...)
+	m.Stack = m.Stack[:len(m.Stack)-n]
+	return nil
+}
+
+// fromReturn pushes the top n items of the return stack, keeping their
+// order, and removes them from the return stack unless keep is set.
+func (m *Machine) fromReturn(op string, n int, keep bool) error {
+	err := m.needReturn(op, n)
+	if err != nil {
+		return err
+	}
+
+	m.Stack = append(m.Stack, m.rstack[len(m.rstack)-n:]...)
+	if !keep {
+		m.rstack = m.rstack[:len(m.rstack)-n]
+	}
+
+	return nil
+}
+
+// toR moves the top of the stack to the return stack: a -- , R: -- a.
+func (m *Machine) toR(st *parser.ToRStatement) error {
+	return m.toReturn(">r", 1)
+}
+
+// fromR moves the top of the return stack to the stack: -- a, R: a -- .
+func (m *Machine) fromR(st *parser.FromRStatement) error {
+	return m.fromReturn("r>", 1, false)
+}
+
+// rFetch pushes a copy of the top of the return stack: -- a, R: a -- a.
+func (m *Machine) rFetch(st *parser.RFetchStatement) error {
+	return m.fromReturn("r@", 1, true)
+}
+
+// twoToR moves the top pair of the stack to the return stack:
+// a b -- , R: -- a b.
+func (m *Machine) twoToR(st *parser.TwoToRStatement) error {
+	return m.toReturn("2>r", 2)
+}
+
+// twoFromR moves the top pair of the return stack to the stack:
+// -- a b, R: a b -- .
+func (m *Machine) twoFromR(st *parser.TwoFromRStatement) error {
+	return m.fromReturn("2r>", 2, false)
+}
+
+// twoRFetch pushes a copy of the top pair of the return stack:
+// -- a b, R: a b -- a b.
+func (m *Machine) twoRFetch(st *parser.TwoRFetchStatement) error {
+	return m.fromReturn("2r@", 2, true)
+}
+
+// returns pushes the number of items on the return stack. It is not called
+// rdepth, which counts function calls.
+func (m *Machine) returns(st *parser.ReturnsStatement) error {
+	m.Stack = append(m.Stack, Int(len(m.rstack)))
+	return nil
+}
@@ -0,0 +1,94 @@
+package runner
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/noonien/techon/parser"
+)
+
+// Run parses the program read from r and executes it on a new Machine, which
+// is returned even if execution fails so its stack and memory can be
+// inspected. Parse failures are returned as a *ParseError.
+func Run(r io.Reader) (*Machine, error) {
+	prog, err := parser.NewParser(r).Parse()
+	if err != nil {
+		return nil, &ParseError{Err: err}
+	}
+
+	m := NewMachine()
+	return m, m.Execute(prog)
+}
+
+// RunStream executes the program read from r on m one top-level statement at
+// a time, as it is parsed, without holding the whole program in memory.
+// Unlike Execute, functions and variables must be declared before the
+// statements using them. As with Execute, a program consisting only of
+// declarations and comments which defines a main function is run by calling
+// main at the end.
+func RunStream(r io.Reader, m *Machine) error {
+	p := parser.NewParser(r)
+
+	var main *parser.FunctionStatement
+	statements := false
+	for {
+		st, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return &ParseError{Err: err}
+		}
+
+		switch st := st.(type) {
+		case *parser.FunctionStatement:
+			if m.key(st.Name) == m.key("main") {
+				main = st
+			}
+		case *parser.Comment:
+		default:
+			if !isDeclaration(st) {
+				statements = true
+			}
+		}
+
+		err = m.exec(st)
+		if err != nil {
+			// a quit stops the program without an error
+			return m.topLevel(err)
+		}
+	}
+
+	if main != nil && !statements {
+		return m.topLevel(m.call(main))
+	}
+
+	return nil
+}
+
+// RunAll runs each of the programs in src, separated by ---, on a fresh
+// Machine and returns their final stacks as integers, truncating
+// floating-point numbers toward zero.
+func RunAll(src string) ([][]int, error) {
+	progs, err := parser.NewParser(strings.NewReader(src)).ParseAll()
+	if err != nil {
+		return nil, &ParseError{Err: err}
+	}
+
+	stacks := make([][]int, len(progs))
+	for i, prog := range progs {
+		m := NewMachine()
+		err := m.Execute(prog)
+		if err != nil {
+			return nil, fmt.Errorf("program %d: %w", i+1, err)
+		}
+
+		stacks[i] = make([]int, len(m.Stack))
+		for j, val := range m.Stack {
+			stacks[i][j] = val.Int()
+		}
+	}
+
+	return stacks, nil
+}
@@ -0,0 +1,151 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRunStream(t *testing.T) {
+	for _, src := range []string{
+		"1 2 + 3 *",
+		": sq dup * ;\n: quad sq sq ;\n3 quad 2 sq",
+		"variable x 5 x ! : inc x @ 1+ x ! ; inc inc x @",
+		"0 10 dup while 1 - swap 1+ swap dup repeat drop",
+		"5 case 5 of 50 endof 0 endcase",
+		"1 2 quit 3",
+	} {
+		batch := NewMachine()
+		if err := run(t, batch, src); err != nil {
+			t.Fatalf("%q: %v", src, err)
+		}
+
+		stream := NewMachine()
+		if err := RunStream(strings.NewReader(src), stream); err != nil {
+			t.Fatalf("%q: streaming: %v", src, err)
+		}
+
+		got, want := fmt.Sprint(stream.Stack), fmt.Sprint(batch.Stack)
+		if got != want {
+			t.Errorf("%q: streaming left %s, want %s", src, got, want)
+		}
+	}
+
+	err := RunStream(strings.NewReader("1 2 +\n: f"), NewMachine())
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Errorf("got %v, want a ParseError", err)
+	}
+}
+
+func TestRunStreamMain(t *testing.T) {
+	tests := []stackTest{
+		{": main 1 ;", "[1]"},
+		{": main 1 ; main", "[1]"},
+		{"(entry point) : main 1 ;", "[1]"},
+		{"5 : f 1 ;", "[5]"},
+	}
+
+	for _, tt := range tests {
+		m := NewMachine()
+		err := RunStream(strings.NewReader(tt.src), m)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.src, err)
+		}
+
+		if got := fmt.Sprint(m.Stack); got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestRunStreamReusedMachine(t *testing.T) {
+	m := NewMachine()
+	for _, src := range []string{": main 1 ;", ": f 2 ;", "3"} {
+		if err := RunStream(strings.NewReader(src), m); err != nil {
+			t.Fatalf("%q: %v", src, err)
+		}
+	}
+
+	// only the stream declaring main runs it
+	if got := fmt.Sprint(m.Stack); got != "[1 3]" {
+		t.Errorf("got %s, want [1 3]", got)
+	}
+}
+
+func TestCaseInsensitiveMain(t *testing.T) {
+	for _, insensitive := range []bool{false, true} {
+		want := "[]"
+		if insensitive {
+			want = "[1]"
+		}
+
+		runs := map[string]func(m *Machine, src string) error{
+			"Execute": func(m *Machine, src string) error {
+				return run(t, m, src)
+			},
+			"Compile": func(m *Machine, src string) error {
+				return compile(t, src).Run(m)
+			},
+			"RunStream": func(m *Machine, src string) error {
+				return RunStream(strings.NewReader(src), m)
+			},
+		}
+
+		for name, runProg := range runs {
+			m := NewMachine()
+			m.CaseInsensitiveIdentifiers = insensitive
+
+			if err := runProg(m, ": MAIN 1 ;"); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if got := fmt.Sprint(m.Stack); got != want {
+				t.Errorf("%s with case-insensitive %v: got %s, want %s", name, insensitive, got, want)
+			}
+		}
+	}
+}
+
+func TestRunAll(t *testing.T) {
+	stacks, err := RunAll("variable x 5 x ! x @ : f 1 ; f\n---\nvariable x x @ 2.5\n---\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := fmt.Sprint(stacks); got != "[[5 1] [0 2] []]" {
+		t.Errorf("got %s, want [[5 1] [0 2] []]", got)
+	}
+
+	// functions do not leak into the following programs either
+	_, err = RunAll(": f 1 ; f\n---\nf")
+	var unresolved *UnresolvedIdentifierError
+	if !errors.As(err, &unresolved) {
+		t.Errorf("got %v, want an UnresolvedIdentifierError", err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	m, err := Run(strings.NewReader("variable x 3 x ! x @ 4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := fmt.Sprint(m.Stack); got != "[3 4]" {
+		t.Errorf("got %s, want [3 4]", got)
+	}
+
+	var parseErr *ParseError
+	m, err = Run(strings.NewReader(": f"))
+	if !errors.As(err, &parseErr) || m != nil {
+		t.Errorf("got %v, want a ParseError and no machine", err)
+	}
+
+	m, err = Run(strings.NewReader("1 2 drop drop drop"))
+	if err == nil || errors.As(err, &parseErr) {
+		t.Errorf("got %v, want an execution error", err)
+	}
+	if m == nil {
+		t.Error("the machine is not returned when execution fails")
+	}
+}
@@ -0,0 +1,166 @@
+package runner
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/noonien/techon/lexer"
+	"github.com/noonien/techon/parser"
+)
+
+// Format writes prog to w as Techon source, one top-level statement per
+// line. Parsing the result gives back prog, except that keywords are written
+// in lowercase and comments in parentheses.
+func Format(prog parser.Program, w io.Writer) error {
+	for _, st := range prog {
+		_, err := fmt.Fprintln(w, source(st))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// see prints the source of the function st.Name.
+func (m *Machine) see(st *parser.SeeStatement) error {
+	fn, ok := m.Functions[m.key(st.Name)]
+	if !ok {
+		return &UnresolvedIdentifierError{Name: st.Name}
+	}
+
+	_, err := fmt.Fprintln(m.out, source(fn))
+	return err
+}
+
+// source returns st as Techon source on a single line.
+func source(st parser.Statement) string {
+	switch st := st.(type) {
+	case *parser.Comment:
+		return "(" + st.Body + ")"
+
+	case *parser.DeclarationStatement:
+		if st.Cells == 1 {
+			return "variable " + st.Name
+		}
+		return fmt.Sprintf("variable %s %d cells", st.Name, st.Cells)
+
+	case *parser.FunctionStatement:
+		return ": " + st.Name + sourceBody(st.Body) + " ;"
+
+	case *parser.PushNumberStatement:
+		return strconv.Itoa(st.Number)
+
+	case *parser.PushFloatStatement:
+		return Float(st.Number).String()
+
+	case *parser.IdentifierCallStatement:
+		return st.Identifier
+
+	case *parser.TickStatement:
+		return "' " + st.Name
+
+	case *parser.AliasStatement:
+		return "alias " + st.Name + " " + st.Target
+
+	case *parser.EnumStatement:
+		return "enum " + strings.Join(st.Names, " ")
+
+	case *parser.DefinedStatement:
+		return "defined? " + st.Name
+
+	case *parser.AbortStatement:
+		return "abort\" " + st.Message + "\""
+
+	case *parser.ValueStatement:
+		return "value " + st.Name
+
+	case *parser.ToStatement:
+		return "to " + st.Name
+
+	case *parser.SeeStatement:
+		return "see " + st.Name
+
+	case *parser.IfStatement:
+		src := "if" + sourceBody(st.Body)
+		if len(st.ElseBody) > 0 {
+			src += " else" + sourceBody(st.ElseBody)
+		}
+		return src + " then"
+
+	case *parser.WhileStatement:
+		return "while" + sourceBody(st.Body) + " repeat"
+
+	case *parser.TimeStatement:
+		return "time" + sourceBody(st.Body) + " endtime"
+
+	case *parser.CaseStatement:
+		src := "case"
+		for _, clause := range st.Cases {
+			src += fmt.Sprintf(" %d of%s endof", clause.Value, sourceBody(clause.Body))
+		}
+		return src + sourceBody(st.Default) + " endcase"
+	}
+
+	return keyword(st)
+}
+
+// sourceBody returns the source of the statements in body, each preceded by
+// a space.
+func sourceBody(body []parser.Statement) string {
+	var sb strings.Builder
+	for _, st := range body {
+		sb.WriteString(" ")
+		sb.WriteString(source(st))
+	}
+
+	return sb.String()
+}
+
+// keyword returns the word a statement without operands is written as.
+func keyword(st parser.Statement) string {
+	switch st := st.(type) {
+	case *parser.MathOperationStatement:
+		return strings.Trim(symbols[st.Op], "'")
+	case parser.UnaryOperationStatement:
+		return strings.Trim(symbols[lexer.Token(st)], "'")
+	case parser.CompareOperationStatement:
+		return strings.Trim(symbols[lexer.Token(st)], "'")
+	case *parser.GetStatement:
+		return "@"
+	case *parser.StoreStatement:
+		return "!"
+	case *parser.PrintStatement:
+		return "."
+	case *parser.PrintStackStatement:
+		return ".s"
+	case *parser.QDupStatement:
+		return "?dup"
+	case *parser.QExecuteStatement:
+		return "?execute"
+	case *parser.RollAllStatement:
+		return "roll-all"
+	case *parser.EmptyStatement:
+		return "empty?"
+	case *parser.OverflowedStatement:
+		return "overflow?"
+	case *parser.NumWordsStatement:
+		return "#words"
+	case *parser.NumVarsStatement:
+		return "#vars"
+	case *parser.FromBufferStatement:
+		return "buffer>"
+	case *parser.FromRStatement:
+		return "r>"
+	case *parser.RFetchStatement:
+		return "r@"
+	case *parser.TwoFromRStatement:
+		return "2r>"
+	case *parser.TwoRFetchStatement:
+		return "2r@"
+	}
+
+	return word(st)
+}
@@ -0,0 +1,85 @@
+package runner
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/noonien/techon/parser"
+)
+
+func TestFormat(t *testing.T) {
+	// each statement is already formatted
+	statements := []string{
+		"variable x",
+		"variable y 3 cells",
+		"-2",
+		"3.5",
+		"x",
+		": double 2 * ;",
+		": f 1 if 2 else 3 then while 4 repeat time 5 endtime ;",
+		": g leave exit ;",
+		"case 1 of 2 endof -3 of endof 4 endcase",
+		"' f",
+		"defined? f",
+		"alias g f",
+		"enum a b c",
+		"value v",
+		"to v",
+		"see f",
+		"abort\" went wrong\"",
+		"( a comment )",
+	}
+
+	words := `+ - * / mod 1+ 1- 2+ 2- 2* 2/ = <> < > <= >= @ ! . .s u. hex decimal
+		drop dup ?dup swap 2over 2nip third fourth roll-all empty? not execute
+		?execute fill move size dump maxint minint mark arity bool flag sqrt gcd
+		lcm cell+ read modpow random hash words factorial erase compare-mem
+		>buffer buffer> sort find #words #vars overflow? getch type >r r> r@ 2>r
+		2r> 2r@ rdepth returns byte@ byte! c@ c! within /mod */ */mod reverse
+		allot here quit`
+	statements = append(statements, strings.Fields(words)...)
+
+	for _, src := range statements {
+		var buf bytes.Buffer
+		if err := Format(parse(t, src), &buf); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := buf.String(); got != src+"\n" {
+			t.Errorf("got %q, want %q", got, src+"\n")
+		}
+	}
+}
+
+func TestFormatParsesBack(t *testing.T) {
+	src, err := os.ReadFile("testdata/disasm.to")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prog := parse(t, string(src))
+
+	var formatted bytes.Buffer
+	if err := Format(prog, &formatted); err != nil {
+		t.Fatal(err)
+	}
+
+	reparsed, err := parser.NewParser(strings.NewReader(formatted.String())).Parse()
+	if err != nil {
+		t.Fatalf("parsing the formatted program: %v\n%s", err, formatted.String())
+	}
+
+	var want, got bytes.Buffer
+	if err := Disassemble(prog, &want); err != nil {
+		t.Fatal(err)
+	}
+	if err := Disassemble(reparsed, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.String() != want.String() {
+		t.Errorf("formatting changed the program:\n%s", formatted.String())
+	}
+}
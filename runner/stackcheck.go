@@ -0,0 +1,418 @@
+package runner
+
+import (
+	"strings"
+
+	"github.com/noonien/techon/lexer"
+	"github.com/noonien/techon/parser"
+)
+
+// StackCheck statically looks for statements that are certain to underflow
+// the stack, returning a StackUnderflowError for the first one found.
+//
+// The check is an approximation: it tracks the smallest and largest possible
+// stack depth through straight-line code and both branches of ifs, and stops
+// at the first loop, function call or statement whose effect cannot be known
+// before running the program. Only underflows that would happen on every
+// possible execution are reported, so a nil error does not mean the program
+// is safe.
+func StackCheck(prog parser.Program) error {
+	c := &stackChecker{vars: make(map[string]bool)}
+	for _, st := range prog {
+		switch st := st.(type) {
+		case *parser.DeclarationStatement:
+			c.vars[st.Name] = true
+		case *parser.EnumStatement:
+			for _, name := range st.Names {
+				c.vars[name] = true
+			}
+		case *parser.ValueStatement:
+			c.vars[st.Name] = true
+		}
+	}
+
+	_, _, err := c.check(prog, depthRange{})
+	return err
+}
+
+// depthRange is the range of possible stack depths at a point in a program.
+type depthRange struct {
+	min, max int
+}
+
+type stackChecker struct {
+	vars map[string]bool
+}
+
+// check estimates the stack depth after running body starting from d. ok is
+// false if the analysis had to give up before reaching the end of body.
+func (c *stackChecker) check(body []parser.Statement, d depthRange) (depthRange, bool, error) {
+	for _, st := range body {
+		switch st := st.(type) {
+		case *parser.IfStatement:
+			var err error
+			d, err = c.apply(st, d, 1, 0)
+			if err != nil {
+				return d, false, err
+			}
+
+			then, ok, err := c.check(st.Body, d)
+			if err != nil || !ok {
+				return d, false, err
+			}
+
+			els, ok, err := c.check(st.ElseBody, d)
+			if err != nil || !ok {
+				return d, false, err
+			}
+
+			d = depthRange{min: min(then.min, els.min), max: max(then.max, els.max)}
+
+		case *parser.CaseStatement:
+			var err error
+			d, err = c.apply(st, d, 1, 0)
+			if err != nil {
+				return d, false, err
+			}
+
+			res, ok, err := c.check(st.Default, d)
+			if err != nil || !ok {
+				return d, false, err
+			}
+
+			for _, clause := range st.Cases {
+				cd, ok, err := c.check(clause.Body, d)
+				if err != nil || !ok {
+					return d, false, err
+				}
+
+				res = depthRange{min: min(res.min, cd.min), max: max(res.max, cd.max)}
+			}
+
+			d = res
+
+		case *parser.TimeStatement:
+			var ok bool
+			var err error
+			d, ok, err = c.check(st.Body, d)
+			if err != nil || !ok {
+				return d, false, err
+			}
+
+		case *parser.WhileStatement:
+			// the first condition is always checked, but the number of
+			// iterations is unknown
+			_, err := c.apply(st, d, 1, 0)
+			return d, false, err
+
+		default:
+			in, out, ok := c.effect(st)
+			if !ok {
+				return d, false, nil
+			}
+
+			var err error
+			d, err = c.apply(st, d, in, out)
+			if err != nil {
+				return d, false, err
+			}
+		}
+	}
+
+	return d, true, nil
+}
+
+// apply returns the depth after st pops in items and pushes out items,
+// failing if the stack certainly holds less than in items.
+func (c *stackChecker) apply(st parser.Statement, d depthRange, in, out int) (depthRange, error) {
+	if d.max < in {
+		return d, &StackUnderflowError{Op: word(st), Need: in, Have: d.max}
+	}
+
+	// execution only continues past st if at least in items were present
+	return depthRange{min: max(d.min, in) - in + out, max: d.max - in + out}, nil
+}
+
+// word returns the name st is referred to by in the errors raised when it
+// underflows at run time.
+func word(st parser.Statement) string {
+	switch st := st.(type) {
+	case *parser.MathOperationStatement:
+		return symbols[st.Op]
+	case parser.UnaryOperationStatement:
+		return symbols[lexer.Token(st)]
+	case parser.CompareOperationStatement:
+		return symbols[lexer.Token(st)]
+	case *parser.TwoOverStatement:
+		return "2over"
+	case *parser.TwoNipStatement:
+		return "2nip"
+	case *parser.UPrintStatement:
+		return "u."
+	case *parser.DivModStatement:
+		return "/mod"
+	case *parser.MulDivStatement:
+		return "*/"
+	case *parser.MulDivModStatement:
+		return "*/mod"
+	case *parser.ToBufferStatement:
+		return ">buffer"
+	case *parser.CompareMemStatement:
+		return "compare-mem"
+	case *parser.ByteGetStatement:
+		return "byte@"
+	case *parser.ByteStoreStatement:
+		return "byte!"
+	case *parser.CFetchStatement:
+		return "c@"
+	case *parser.CStoreStatement:
+		return "c!"
+	case *parser.CellPlusStatement:
+		return "cell+"
+	case *parser.AbortStatement:
+		return "abort\""
+	case *parser.ToRStatement:
+		return ">r"
+	case *parser.TwoToRStatement:
+		return "2>r"
+	}
+
+	return strings.ToLower(opcode(st))
+}
+
+// effect returns the number of items st pops and pushes. ok is false if the
+// effect depends on the state of the machine.
+func (c *stackChecker) effect(st parser.Statement) (in, out int, ok bool) {
+	switch st := st.(type) {
+	case *parser.Comment, *parser.DeclarationStatement, *parser.FunctionStatement:
+		return 0, 0, true
+
+	case *parser.PushNumberStatement, *parser.PushFloatStatement, *parser.TickStatement, *parser.DefinedStatement:
+		return 0, 1, true
+
+	case *parser.IdentifierCallStatement:
+		// functions may have any effect
+		return 0, 1, c.vars[st.Identifier]
+
+	case *parser.MathOperationStatement, parser.CompareOperationStatement:
+		return 2, 1, true
+
+	case parser.UnaryOperationStatement:
+		return 1, 1, true
+
+	case *parser.DropStatement:
+		return 1, 0, true
+
+	case *parser.DupStatement:
+		return 1, 2, true
+
+	case *parser.SwapStatement:
+		return 2, 2, true
+
+	case *parser.TwoOverStatement:
+		return 4, 6, true
+
+	case *parser.TwoNipStatement:
+		return 4, 2, true
+
+	case *parser.GetStatement:
+		return 1, 1, true
+
+	case *parser.StoreStatement:
+		return 2, 0, true
+
+	case *parser.PrintStatement:
+		return 1, 0, true
+
+	case *parser.HexStatement, *parser.DecimalStatement:
+		return 0, 0, true
+
+	case *parser.PrintStackStatement:
+		return 0, 0, true
+
+	case *parser.FillStatement:
+		return 3, 0, true
+
+	case *parser.MoveStatement:
+		return 3, 0, true
+
+	case *parser.SizeStatement:
+		return 1, 1, true
+
+	case *parser.DumpStatement:
+		return 2, 0, true
+
+	case *parser.MaxIntStatement:
+		return 0, 1, true
+
+	case *parser.MinIntStatement:
+		return 0, 1, true
+
+	case *parser.MarkStatement:
+		return 0, 0, true
+
+	case *parser.ArityStatement:
+		return 0, 1, true
+
+	case *parser.BoolStatement:
+		return 1, 1, true
+
+	case *parser.FlagStatement:
+		return 1, 1, true
+
+	case *parser.SqrtStatement:
+		return 1, 1, true
+
+	case *parser.GcdStatement:
+		return 2, 1, true
+
+	case *parser.LcmStatement:
+		return 2, 1, true
+
+	case *parser.RollAllStatement:
+		return 0, 0, true
+
+	case *parser.EmptyStatement:
+		return 0, 1, true
+
+	case *parser.CellPlusStatement:
+		return 2, 1, true
+
+	case *parser.ReadStatement:
+		return 2, 1, true
+
+	case *parser.ModPowStatement:
+		return 3, 1, true
+
+	case *parser.RandomStatement:
+		return 1, 1, true
+
+	case *parser.HashStatement:
+		return 2, 1, true
+
+	case *parser.ThirdStatement:
+		return 3, 4, true
+
+	case *parser.FourthStatement:
+		return 4, 5, true
+
+	case *parser.NotStatement:
+		return 1, 1, true
+
+	case *parser.WordsStatement:
+		return 0, 0, true
+
+	case *parser.FactorialStatement:
+		return 1, 1, true
+
+	case *parser.AliasStatement:
+		return 0, 0, true
+
+	case *parser.EraseStatement:
+		return 2, 0, true
+
+	case *parser.CompareMemStatement:
+		return 3, 1, true
+
+	case *parser.UPrintStatement:
+		return 1, 0, true
+
+	case *parser.RDepthStatement:
+		return 0, 1, true
+
+	case *parser.ToBufferStatement:
+		return 2, 0, true
+
+	case *parser.FromBufferStatement:
+		return 0, 1, true
+
+	case *parser.SortStatement:
+		return 2, 0, true
+
+	case *parser.FindStatement:
+		return 3, 1, true
+
+	case *parser.NumWordsStatement:
+		return 0, 1, true
+
+	case *parser.NumVarsStatement:
+		return 0, 1, true
+
+	case *parser.OverflowedStatement:
+		return 0, 1, true
+
+	case *parser.EnumStatement:
+		return 0, 0, true
+
+	case *parser.GetchStatement:
+		return 0, 1, true
+
+	case *parser.TypeStatement:
+		return 2, 0, true
+
+	case *parser.ToRStatement:
+		return 1, 0, true
+
+	case *parser.FromRStatement:
+		return 0, 1, true
+
+	case *parser.RFetchStatement:
+		return 0, 1, true
+
+	case *parser.TwoToRStatement:
+		return 2, 0, true
+
+	case *parser.TwoFromRStatement:
+		return 0, 2, true
+
+	case *parser.TwoRFetchStatement:
+		return 0, 2, true
+
+	case *parser.ReturnsStatement:
+		return 0, 1, true
+
+	case *parser.SeeStatement:
+		return 0, 0, true
+
+	case *parser.AbortStatement:
+		return 1, 0, true
+
+	case *parser.ValueStatement:
+		return 1, 0, true
+
+	case *parser.ToStatement:
+		return 1, 0, true
+
+	case *parser.ByteGetStatement:
+		return 2, 1, true
+
+	case *parser.ByteStoreStatement:
+		return 3, 0, true
+
+	case *parser.WithinStatement:
+		return 3, 1, true
+
+	case *parser.DivModStatement:
+		return 2, 2, true
+
+	case *parser.MulDivStatement:
+		return 3, 1, true
+
+	case *parser.MulDivModStatement:
+		return 3, 2, true
+
+	case *parser.AllotStatement:
+		return 1, 1, true
+
+	case *parser.HereStatement:
+		return 0, 1, true
+
+	case *parser.CFetchStatement:
+		return 1, 1, true
+
+	case *parser.CStoreStatement:
+		return 2, 0, true
+	}
+
+	return 0, 0, false
+}
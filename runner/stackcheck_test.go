@@ -0,0 +1,59 @@
+package runner
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStackCheck(t *testing.T) {
+	tests := []struct {
+		src string
+		op  string
+	}{
+		{"1 2 + .", ""},
+		{"1 +", "'+'"},
+		{"drop", "drop"},
+		{"1 if 2 else 3 4 then +", ""},
+		{"1 if 2 else 3 then +", "'+'"},
+		{"variable x x @ +", "'+'"},
+		{": f 1 2 ; f +", ""},
+		{"0 while 1 repeat", ""},
+		{"while 1 repeat", "while"},
+	}
+
+	for _, tt := range tests {
+		err := StackCheck(parse(t, tt.src))
+
+		var underflow *StackUnderflowError
+		switch {
+		case tt.op == "" && err != nil:
+			t.Errorf("%q: got %v, want no error", tt.src, err)
+		case tt.op != "" && !errors.As(err, &underflow):
+			t.Errorf("%q: got %v, want a StackUnderflowError", tt.src, err)
+		case tt.op != "" && underflow.Op != tt.op:
+			t.Errorf("%q: got underflow in %s, want %s", tt.src, underflow.Op, tt.op)
+		}
+	}
+}
+
+func TestStackCheckNamesMatchRuntime(t *testing.T) {
+	for _, src := range []string{
+		"+", "mod", "1+", "2/", "<=", "drop", "2over", "@", "!", ".", "u.",
+		"/mod", "*/mod", ">buffer", "compare-mem", "byte@", "c!", "cell+",
+		`abort" x"`, ">r", "2>r", "if 1 then",
+	} {
+		var static, runtime *StackUnderflowError
+		if !errors.As(StackCheck(parse(t, src)), &static) {
+			t.Errorf("%q: no static underflow", src)
+			continue
+		}
+		if !errors.As(run(t, NewMachine(), src), &runtime) {
+			t.Errorf("%q: no underflow when run", src)
+			continue
+		}
+
+		if static.Op != runtime.Op {
+			t.Errorf("%q: static check names %s, running names %s", src, static.Op, runtime.Op)
+		}
+	}
+}
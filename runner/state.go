@@ -1,24 +1,148 @@
 package runner
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"math/bits"
+	"math/rand"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/noonien/techon/lexer"
 	"github.com/noonien/techon/parser"
 )
 
+// strictStride is the alignment of variable base addresses when
+// StrictMemory is enabled. Every variable is followed by unmapped addresses
+// up to the next multiple of strictStride, so running past its end cannot
+// land inside a neighbouring variable.
+const strictStride = 1 << 20
+
+// DefaultMaxVariableCells is the MaxVariableCells of a new Machine.
+const DefaultMaxVariableCells = 1 << 24
+
 type Machine struct {
 	Addresses map[string]int
 	Variables []*Variable
 	Functions map[string]*parser.FunctionStatement
-	Stack     []int
+	Constants map[string]int
+	Values    map[string]int
+	Stack     []Value
+
+	// StrictMemory places variables in disjoint address ranges and checks
+	// that an address taken from a variable, after any offsets added to
+	// it, still lies within that variable. Accessing past the end of a
+	// variable fails instead of silently reading or writing the next one.
+	// It only affects variables declared after it is set.
+	StrictMemory bool
+
+	// EnableDebugComments makes comments starting with "debug stack" or
+	// "debug var name" print the stack or a variable to the output when
+	// executed. It is enabled by default.
+	EnableDebugComments bool
+
+	// StrictIdentifiers makes calling an identifier that is not defined an
+	// error. When disabled, such calls print a warning and do nothing. It
+	// is enabled by default.
+	StrictIdentifiers bool
+
+	// CaseInsensitiveIdentifiers makes names that only differ in case, such
+	// as foo and FOO, refer to the same variable, function, constant, value
+	// or registered word. Names are then stored in lowercase in Addresses,
+	// Functions, Constants and Values. It must be set before anything is
+	// declared.
+	CaseInsensitiveIdentifiers bool
+
+	// MaxVariableCells is the largest number of cells a single variable can
+	// be declared with, so that huge declarations fail instead of
+	// exhausting memory. Zero means no limit.
+	MaxVariableCells int
+
+	// MaxTotalCells is the largest number of cells all variables together
+	// can use, including the locals of the functions being executed. Zero
+	// means no limit.
+	MaxTotalCells int
+
+	// tailCalls holds the self-recursive calls in tail position of the
+	// defined functions.
+	tailCalls map[*parser.IdentifierCallStatement]bool
+
+	// compiled holds the compiled bodies of the functions declared by
+	// Compiled programs, run instead of interpreting the body.
+	compiled map[*parser.FunctionStatement]*Compiled
+
+	// xts holds the defined functions, indexed by execution token.
+	xts []*parser.FunctionStatement
+
+	// rstack is the return stack, holding the items moved there by >r and
+	// 2>r.
+	rstack []Value
+
+	// marks holds the stack depths recorded by mark, innermost last.
+	marks []int
+
+	// frames holds the local variables of the functions being executed,
+	// innermost last.
+	frames []*frame
+
+	// IntBits is the width of integers in bits. Integer literals and
+	// results wrap around at this width, so with 32 the machine behaves like
+	// one with 32-bit cells. It is 64 by default.
+	IntBits int
+
+	// CheckOverflow makes integer arithmetic whose result does not fit in
+	// IntBits bits fail with ErrOverflow instead of wrapping around.
+	CheckOverflow bool
+
+	// overflowed records whether the last arithmetic operation overflowed,
+	// for overflow?.
+	overflowed bool
+
+	// Base is the radix used when printing integers, 10 by default.
+	Base int
+
+	// out receives everything printed by the program.
+	out io.Writer
+
+	// rand generates the numbers pushed by random.
+	rand *rand.Rand
+
+	// buffer receives the output while it is redirected to memory by
+	// >buffer, and holds the writer to restore afterwards.
+	buffer *cellWriter
+
+	// in is where read and getch get their input from, if set.
+	in *bufio.Reader
+
+	// profile counts executed statements by type name, if enabled.
+	profile map[string]int
+
+	// builtins holds the words registered by the host, by name.
+	builtins map[string]func(m *Machine) error
+
+	// breakpoints holds the callbacks invoked when calling functions, by
+	// function name.
+	breakpoints map[string]func(m *Machine)
+}
+
+// frame holds the local variables of a function call.
+type frame struct {
+	addrs map[string]int
+
+	// base is the number of variables allocated before the call.
+	base int
 }
 
 type Variable struct {
 	Name string
+	Addr int
 	Size int
 	Data []int
 }
@@ -27,21 +151,167 @@ func NewMachine() *Machine {
 	return &Machine{
 		Addresses: make(map[string]int),
 		Functions: make(map[string]*parser.FunctionStatement),
+		Constants: make(map[string]int),
+		Values:    make(map[string]int),
+		tailCalls: make(map[*parser.IdentifierCallStatement]bool),
+
+		EnableDebugComments: true,
+		StrictIdentifiers:   true,
+		MaxVariableCells:    DefaultMaxVariableCells,
+		IntBits:             64,
+		Base:                10,
+		out:                 os.Stdout,
+		rand:                rand.New(rand.NewSource(1)),
+	}
+}
+
+// SetOutput sets the writer printed output is written to. It defaults to
+// os.Stdout.
+func (m *Machine) SetOutput(w io.Writer) {
+	m.out = w
+}
+
+// Seed reseeds the generator used by random. Machines start with the same
+// seed, so runs are reproducible unless seeded otherwise.
+func (m *Machine) Seed(seed int64) {
+	m.rand.Seed(seed)
+}
+
+// SetInput sets the reader the read and getch words read from. Without an
+// input, they find nothing to read.
+func (m *Machine) SetInput(r io.Reader) {
+	if r == nil {
+		m.in = nil
+		return
 	}
+
+	m.in = bufio.NewReader(r)
 }
 
+// Execute runs st. A quit stops execution without an error.
 func (m *Machine) Execute(st parser.Statement) error {
-	return m.exec(st)
+	return m.topLevel(m.exec(st))
+}
+
+// topLevel converts control flow errors reaching the top of the program to
+// what they mean there. Output redirected by >buffer is restored, since the
+// program stops before reaching buffer>.
+func (m *Machine) topLevel(err error) error {
+	if err != nil {
+		m.restoreOutput()
+	}
+
+	if errors.Is(err, errQuit) {
+		return nil
+	}
+	if errors.Is(err, errLeave) {
+		return ErrLeaveOutsideLoop
+	}
+	if errors.Is(err, errExit) {
+		return ErrExitOutsideFunction
+	}
+
+	return err
+}
+
+// EnableProfiling starts counting executed statements by type. Counts are
+// available through Profile.
+func (m *Machine) EnableProfiling() {
+	if m.profile == nil {
+		m.profile = make(map[string]int)
+	}
+}
+
+// Register defines a word called name which runs fn when called. The name
+// must not already be used by a variable, function or registered word, and
+// cannot be declared by programs afterwards.
+func (m *Machine) Register(name string, fn func(m *Machine) error) error {
+	if kind := m.definedAs(name); kind != "" {
+		return &RedeclarationError{Kind: "builtin", Name: name, Existing: kind}
+	}
+
+	if m.builtins == nil {
+		m.builtins = make(map[string]func(m *Machine) error)
+	}
+	m.builtins[m.key(name)] = fn
+	return nil
+}
+
+// key returns the key name is stored under in the maps of defined names.
+func (m *Machine) key(name string) string {
+	if m.CaseInsensitiveIdentifiers {
+		return strings.ToLower(name)
+	}
+
+	return name
+}
+
+// definedAs returns what the global name is defined as, "variable",
+// "function", "constant", "value" or "builtin", or "" if it is not defined.
+func (m *Machine) definedAs(name string) string {
+	name = m.key(name)
+
+	if _, ok := m.Addresses[name]; ok {
+		return "variable"
+	}
+
+	if _, ok := m.Functions[name]; ok {
+		return "function"
+	}
+
+	if _, ok := m.Constants[name]; ok {
+		return "constant"
+	}
+
+	if _, ok := m.Values[name]; ok {
+		return "value"
+	}
+
+	if _, ok := m.builtins[name]; ok {
+		return "builtin"
+	}
+
+	return ""
+}
+
+// SetBreakpoint makes calls to the function called name invoke fn before
+// the function is entered. A nil fn removes the breakpoint.
+func (m *Machine) SetBreakpoint(name string, fn func(m *Machine)) {
+	if fn == nil {
+		delete(m.breakpoints, m.key(name))
+		return
+	}
+
+	if m.breakpoints == nil {
+		m.breakpoints = make(map[string]func(m *Machine))
+	}
+	m.breakpoints[m.key(name)] = fn
+}
+
+// Profile returns the number of executed statements keyed by statement type
+// name, e.g. "DupStatement". It returns nil unless profiling is enabled.
+func (m *Machine) Profile() map[string]int {
+	if m.profile == nil {
+		return nil
+	}
+
+	profile := make(map[string]int, len(m.profile))
+	for name, count := range m.profile {
+		profile[name] = count
+	}
+	return profile
 }
 
 func (m *Machine) exec(st parser.Statement) error {
+	if _, ok := st.(parser.Program); !ok && m.profile != nil {
+		m.profile[statementName(st)]++
+	}
+
 	switch st := st.(type) {
 	case parser.Program:
-		for _, cst := range st {
-			err := m.exec(cst)
-			if err != nil {
-				return err
-			}
+		err := m.program(st)
+		if err != nil {
+			return err
 		}
 
 	case *parser.Comment:
@@ -68,301 +338,1958 @@ func (m *Machine) exec(st parser.Statement) error {
 			return err
 		}
 
+	case *parser.PushFloatStatement:
+		err := m.pushFloat(st)
+		if err != nil {
+			return err
+		}
+
 	case *parser.IdentifierCallStatement:
 		err := m.indentifierCall(st)
 		if err != nil {
 			return err
 		}
 
-	case parser.MathOperationStatement:
+	case *parser.MathOperationStatement:
 		err := m.mathOperation(st)
 		if err != nil {
 			return err
 		}
 
-	case *parser.DropStatement:
-		err := m.drop(st)
-		if err != nil {
-			return err
-		}
+	case parser.UnaryOperationStatement:
+		err := m.unaryOperation(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.DropStatement:
+		err := m.drop(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.DupStatement:
+		err := m.dup(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.SwapStatement:
+		err := m.swap(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.TwoOverStatement:
+		err := m.twoOver(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.TwoNipStatement:
+		err := m.twoNip(st)
+		if err != nil {
+			return err
+		}
+
+	case parser.CompareOperationStatement:
+		err := m.compare(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.GetStatement:
+		err := m.get(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.StoreStatement:
+		err := m.store(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.PrintStatement:
+		err := m.print(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.HexStatement:
+		err := m.hex(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.DecimalStatement:
+		err := m.decimal(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.IfStatement:
+		err := m._if(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.WhileStatement:
+		err := m.while(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.TimeStatement:
+		err := m.time(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.QDupStatement:
+		err := m.qdup(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.CaseStatement:
+		err := m._case(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.AliasStatement:
+		err := m.alias(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.DefinedStatement:
+		err := m.defined(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.TickStatement:
+		err := m.tick(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.ExecuteStatement:
+		err := m.execute(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.LeaveStatement:
+		return errLeave
+
+	case *parser.PrintStackStatement:
+		err := m.printStack(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.FillStatement:
+		err := m.fill(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.MoveStatement:
+		err := m.move(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.SizeStatement:
+		err := m.size(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.DumpStatement:
+		err := m.dump(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.MaxIntStatement:
+		err := m.maxInt(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.MinIntStatement:
+		err := m.minInt(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.MarkStatement:
+		err := m.mark(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.ArityStatement:
+		err := m.arity(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.BoolStatement:
+		err := m.bool(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.FlagStatement:
+		err := m.flag(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.SqrtStatement:
+		err := m.sqrt(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.GcdStatement:
+		err := m.gcd(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.LcmStatement:
+		err := m.lcm(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.RollAllStatement:
+		err := m.rollAll(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.EmptyStatement:
+		err := m.empty(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.CellPlusStatement:
+		err := m.cellPlus(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.ReadStatement:
+		err := m.read(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.ModPowStatement:
+		err := m.modPow(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.RandomStatement:
+		err := m.random(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.HashStatement:
+		err := m.hash(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.ThirdStatement:
+		err := m.third(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.FourthStatement:
+		err := m.fourth(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.NotStatement:
+		err := m.not(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.WordsStatement:
+		err := m.words(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.FactorialStatement:
+		err := m.factorial(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.EraseStatement:
+		err := m.erase(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.CompareMemStatement:
+		err := m.compareMem(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.UPrintStatement:
+		err := m.uprint(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.RDepthStatement:
+		err := m.rdepth(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.ToBufferStatement:
+		err := m.toBuffer(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.FromBufferStatement:
+		err := m.fromBuffer(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.SortStatement:
+		err := m.sort(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.FindStatement:
+		err := m.find(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.NumWordsStatement:
+		err := m.numWords(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.NumVarsStatement:
+		err := m.numVars(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.QExecuteStatement:
+		err := m.qexecute(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.OverflowedStatement:
+		err := m.overflowedFlag(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.EnumStatement:
+		err := m.enum(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.GetchStatement:
+		err := m.getch(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.TypeStatement:
+		err := m._type(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.ToRStatement:
+		err := m.toR(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.FromRStatement:
+		err := m.fromR(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.RFetchStatement:
+		err := m.rFetch(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.TwoToRStatement:
+		err := m.twoToR(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.TwoFromRStatement:
+		err := m.twoFromR(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.TwoRFetchStatement:
+		err := m.twoRFetch(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.ReturnsStatement:
+		err := m.returns(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.SeeStatement:
+		err := m.see(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.AbortStatement:
+		err := m.abort(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.ValueStatement:
+		err := m.value(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.ToStatement:
+		err := m.to(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.ByteGetStatement:
+		err := m.byteGet(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.ByteStoreStatement:
+		err := m.byteStore(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.ExitStatement:
+		return errExit
+
+	case *parser.WithinStatement:
+		err := m.within(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.DivModStatement:
+		err := m.divMod(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.MulDivStatement:
+		err := m.mulDiv(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.MulDivModStatement:
+		err := m.mulDivMod(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.ReverseStatement:
+		err := m.reverse(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.AllotStatement:
+		err := m.allot(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.HereStatement:
+		err := m.here(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.CFetchStatement:
+		err := m.cFetch(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.CStoreStatement:
+		err := m.cStore(st)
+		if err != nil {
+			return err
+		}
+
+	case *parser.QuitStatement:
+		return errQuit
+
+	default:
+	}
+
+	return nil
+}
+
+// program registers the variables and functions declared at the top level of
+// prog before executing the rest of it, so functions can be called before
+// the point where they are defined.
+//
+// A program consisting only of declarations and comments which defines a
+// main function is run by calling main.
+func (m *Machine) program(prog parser.Program) error {
+	var main *parser.FunctionStatement
+	for _, st := range prog {
+		if isDeclaration(st) {
+			err := m.exec(st)
+			if err != nil {
+				return err
+			}
+		}
+
+		if fn, ok := st.(*parser.FunctionStatement); ok && m.key(fn.Name) == m.key("main") {
+			main = fn
+		}
+	}
+
+	for _, st := range prog {
+		if isDeclaration(st) {
+			continue
+		}
+
+		if _, ok := st.(*parser.Comment); !ok {
+			main = nil
+		}
+
+		err := m.exec(st)
+		if err != nil {
+			return err
+		}
+	}
+
+	if main != nil {
+		return m.call(main)
+	}
+
+	return nil
+}
+
+func isDeclaration(st parser.Statement) bool {
+	switch st.(type) {
+	case *parser.DeclarationStatement, *parser.FunctionStatement, *parser.EnumStatement:
+		return true
+	}
+
+	return false
+}
+
+func (m *Machine) declareVariable(st *parser.DeclarationStatement) error {
+	if m.MaxVariableCells > 0 && st.Cells > m.MaxVariableCells {
+		return fmt.Errorf("cannot declare variable %q with %d cells, the limit is %d", st.Name, st.Cells, m.MaxVariableCells)
+	}
+
+	if m.MaxTotalCells > 0 {
+		total := st.Cells
+		for _, v := range m.Variables {
+			total += v.Size
+		}
+
+		if total > m.MaxTotalCells {
+			return fmt.Errorf("cannot declare variable %q, variables would use %d cells, the limit is %d", st.Name, total, m.MaxTotalCells)
+		}
+	}
+
+	// variables declared inside a function are local to the call
+	if len(m.frames) > 0 {
+		f := m.frames[len(m.frames)-1]
+		if _, ok := f.addrs[m.key(st.Name)]; ok {
+			return &RedeclarationError{Kind: "variable", Name: st.Name, Existing: "variable", Pos: st.Pos}
+		}
+
+		v := m.allocate(st.Name, st.Cells)
+		f.addrs[m.key(v.Name)] = v.Addr
+		return nil
+	}
+
+	if kind := m.definedAs(st.Name); kind != "" {
+		return &RedeclarationError{Kind: "variable", Name: st.Name, Existing: kind, Pos: st.Pos}
+	}
+
+	v := m.allocate(st.Name, st.Cells)
+	m.Addresses[m.key(v.Name)] = v.Addr
+	return nil
+}
+
+// allocate places a new variable after the last allocated one.
+func (m *Machine) allocate(name string, cells int) *Variable {
+	v := &Variable{
+		Name: name,
+		Size: cells,
+		Data: make([]int, cells),
+	}
+
+	if len(m.Variables) > 0 {
+		lastVar := m.Variables[len(m.Variables)-1]
+		v.Addr = lastVar.Addr + lastVar.Size
+
+		if m.StrictMemory {
+			v.Addr = (v.Addr/strictStride + 1) * strictStride
+		}
+	}
+
+	m.Variables = append(m.Variables, v)
+	return v
+}
+
+func (m *Machine) function(st *parser.FunctionStatement) error {
+	if kind := m.definedAs(st.Name); kind != "" {
+		return &RedeclarationError{Kind: "function", Name: st.Name, Existing: kind, Pos: st.Pos}
+	}
+
+	m.Functions[m.key(st.Name)] = st
+	m.xts = append(m.xts, st)
+	m.markTailCalls(st, st.Body)
+	return nil
+}
+
+func (m *Machine) pushNumber(st *parser.PushNumberStatement) error {
+	m.Stack = append(m.Stack, Int(m.wrap(st.Number)))
+	return nil
+}
+
+// maxInt pushes the largest integer representable in IntBits bits.
+// Arithmetic wraps around, so maxint 1 + is minint unless CheckOverflow is
+// set.
+func (m *Machine) maxInt(st *parser.MaxIntStatement) error {
+	_, hi := m.intRange()
+	m.Stack = append(m.Stack, Int(hi))
+	return nil
+}
+
+// minInt pushes the smallest integer representable in IntBits bits.
+func (m *Machine) minInt(st *parser.MinIntStatement) error {
+	lo, _ := m.intRange()
+	m.Stack = append(m.Stack, Int(lo))
+	return nil
+}
+
+// intRange returns the smallest and largest integers representable in
+// IntBits bits.
+func (m *Machine) intRange() (lo, hi int) {
+	if m.IntBits <= 0 || m.IntBits >= 64 {
+		return math.MinInt, math.MaxInt
+	}
+
+	return -1 << (m.IntBits - 1), 1<<(m.IntBits-1) - 1
+}
+
+func (m *Machine) pushFloat(st *parser.PushFloatStatement) error {
+	m.Stack = append(m.Stack, Float(st.Number))
+	return nil
+}
+
+func (m *Machine) indentifierCall(st *parser.IdentifierCallStatement) error {
+	if addr, ok := m.lookupVariable(st.Identifier); ok {
+		m.Stack = append(m.Stack, m.address(addr))
+		return nil
+	}
+
+	name := m.key(st.Identifier)
+	if fn, ok := m.Functions[name]; ok {
+		if bp := m.breakpoints[name]; bp != nil {
+			bp(m)
+		}
+
+		if m.tailCalls[st] {
+			return errTailCall
+		}
+
+		return withContext(m.call(fn), "in function %q", fn.Name)
+	}
+
+	if val, ok := m.Constants[name]; ok {
+		m.Stack = append(m.Stack, Int(m.wrap(val)))
+		return nil
+	}
+
+	if val, ok := m.Values[name]; ok {
+		m.Stack = append(m.Stack, Int(m.wrap(val)))
+		return nil
+	}
+
+	if fn, ok := m.builtins[name]; ok {
+		return fn(m)
+	}
+
+	err := &UnresolvedIdentifierError{Name: st.Identifier}
+	if !m.StrictIdentifiers {
+		_, werr := fmt.Fprintln(m.out, "warning:", err)
+		return werr
+	}
+
+	return err
+}
+
+// lookupVariable returns the address of the variable called name. Locals of
+// the function being executed shadow global variables and functions.
+func (m *Machine) lookupVariable(name string) (int, bool) {
+	name = m.key(name)
+	if len(m.frames) > 0 {
+		if addr, ok := m.frames[len(m.frames)-1].addrs[name]; ok {
+			return addr, true
+		}
+	}
+
+	addr, ok := m.Addresses[name]
+	return addr, ok
+}
+
+// call executes the body of fn in a new frame. Local variables declared by
+// the body are freed when it returns. Tail calls of fn to itself restart the
+// body instead of recursing.
+func (m *Machine) call(fn *parser.FunctionStatement) error {
+	for {
+		err := m.callFrame(fn)
+		if errors.Is(err, errLeave) {
+			return ErrLeaveOutsideLoop
+		}
+		if err == errExit {
+			return nil
+		}
+		if err != errTailCall {
+			return err
+		}
+	}
+}
+
+func (m *Machine) callFrame(fn *parser.FunctionStatement) error {
+	m.frames = append(m.frames, &frame{
+		addrs: make(map[string]int),
+		base:  len(m.Variables),
+	})
+	defer m.popFrame()
+
+	if code, ok := m.compiled[fn]; ok {
+		return code.exec(m)
+	}
+
+	for _, st := range fn.Body {
+		err := m.exec(st)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// markTailCalls records the calls fn makes to itself as the last statement
+// executed by its body, including the last statements of a trailing if.
+func (m *Machine) markTailCalls(fn *parser.FunctionStatement, body []parser.Statement) {
+	if len(body) == 0 {
+		return
+	}
+
+	switch st := body[len(body)-1].(type) {
+	case *parser.IdentifierCallStatement:
+		if m.key(st.Identifier) == m.key(fn.Name) {
+			m.tailCalls[st] = true
+		}
+
+	case *parser.IfStatement:
+		m.markTailCalls(fn, st.Body)
+		m.markTailCalls(fn, st.ElseBody)
+	}
+}
+
+func (m *Machine) popFrame() {
+	f := m.frames[len(m.frames)-1]
+	m.frames = m.frames[:len(m.frames)-1]
+
+	// keep the regions allotted during the call
+	vars := m.Variables[:f.base]
+	for _, v := range m.Variables[f.base:] {
+		if addr, ok := f.addrs[m.key(v.Name)]; !ok || addr != v.Addr {
+			vars = append(vars, v)
+		}
+	}
+	m.Variables = vars
+}
+
+func (m *Machine) resolveVariable(addr int) (*Variable, int, error) {
+	for _, v := range m.Variables {
+		if v.Addr <= addr && addr < v.Addr+v.Size {
+			return v, addr - v.Addr, nil
+		}
+	}
+
+	return nil, 0, &AddressError{Addr: addr}
+}
+
+func (m *Machine) resolveAddr(addr int) (*int, error) {
+	v, idx, err := m.resolveVariable(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v.Data[idx], nil
+}
+
+// address returns addr as a Value. With StrictMemory, it records the
+// variable addr belongs to so that deref can bounds-check it.
+func (m *Machine) address(addr int) Value {
+	val := Int(addr)
+	if m.StrictMemory {
+		val.owner, _, _ = m.resolveVariable(addr)
+	}
+
+	return val
+}
+
+// deref resolves the address held by val, failing if val was taken from a
+// variable but addr lies outside of it.
+func (m *Machine) deref(val Value) (*int, error) {
+	err := checkOwner(val, val.Int())
+	if err != nil {
+		return nil, err
+	}
+
+	return m.resolveAddr(val.Int())
+}
+
+// checkOwner fails if val was taken from a variable and addr is outside of
+// that variable.
+func checkOwner(val Value, addr int) error {
+	v := val.owner
+	if v == nil || (v.Addr <= addr && addr < v.Addr+v.Size) {
+		return nil
+	}
+
+	return fmt.Errorf("address %d is outside of variable %q", addr, v.Name)
+}
+
+// mathOperation applies an arithmetic operator, reporting where the
+// operator is in the source if it fails.
+func (m *Machine) mathOperation(st *parser.MathOperationStatement) error {
+	err := m.arithmetic(st.Op)
+	if err != nil && st.Pos.Line > 0 {
+		return fmt.Errorf("%w at %s", err, st.Pos)
+	}
+
+	return err
+}
+
+func (m *Machine) arithmetic(op lexer.Token) error {
+	err := m.need(symbols[op], 2)
+	if err != nil {
+		return err
+	}
+
+	op1, op2 := m.Stack[len(m.Stack)-2], m.Stack[len(m.Stack)-1]
+	if op2.IsZero() && (op == lexer.Divide || op == lexer.Modulus) {
+		return ErrDivisionByZero
+	}
+
+	// mixing integers with floats promotes the result to a float
+	if op1.IsFloat() || op2.IsFloat() {
+		a, b := op1.Float(), op2.Float()
+
+		var res float64
+		switch op {
+		case lexer.Minus:
+			res = a - b
+		case lexer.Plus:
+			res = a + b
+		case lexer.Multiply:
+			res = a * b
+		case lexer.Divide:
+			res = a / b
+		case lexer.Modulus:
+			res = math.Mod(a, b)
+		}
+
+		m.overflowed = false
+		m.Stack = append(m.Stack[:len(m.Stack)-2], Float(res))
+		return nil
+	}
+
+	a, b := op1.Int(), op2.Int()
+
+	var res int
+	switch op {
+	case lexer.Minus:
+		res = a - b
+	case lexer.Plus:
+		res = a + b
+	case lexer.Multiply:
+		res = a * b
+	case lexer.Divide:
+		res = a / b
+	case lexer.Modulus:
+		res = a % b
+	}
+
+	m.overflowed = m.overflows(op, a, b, res)
+	if m.CheckOverflow && m.overflowed {
+		return ErrOverflow
+	}
+
+	val := Int(m.wrap(res))
+
+	// offsetting an address keeps it tied to its variable
+	switch {
+	case op == lexer.Plus && op1.owner != nil:
+		val.owner = op1.owner
+	case op == lexer.Plus:
+		val.owner = op2.owner
+	case op == lexer.Minus && op2.owner == nil:
+		val.owner = op1.owner
+	}
+
+	m.Stack = append(m.Stack[:len(m.Stack)-2], val)
+	return nil
+}
+
+// overflowedFlag pushes 1 if the last arithmetic operation overflowed and 0
+// otherwise, and clears the flag.
+func (m *Machine) overflowedFlag(st *parser.OverflowedStatement) error {
+	if m.overflowed {
+		m.Stack = append(m.Stack, Int(1))
+	} else {
+		m.Stack = append(m.Stack, Int(0))
+	}
+
+	m.overflowed = false
+	return nil
+}
+
+// overflows reports whether res, the result of a op b, overflowed or does
+// not fit in IntBits bits.
+func (m *Machine) overflows(op lexer.Token, a, b, res int) bool {
+	switch op {
+	case lexer.Plus:
+		if (a > 0 && b > 0 && res < 0) || (a < 0 && b < 0 && res >= 0) {
+			return true
+		}
+	case lexer.Minus:
+		if (a >= 0 && b < 0 && res < 0) || (a < 0 && b > 0 && res >= 0) {
+			return true
+		}
+	case lexer.Multiply:
+		if a != 0 && (res/a != b || (a == -1 && b == math.MinInt)) {
+			return true
+		}
+	case lexer.Divide:
+		if a == math.MinInt && b == -1 {
+			return true
+		}
+	}
+
+	return res != m.wrap(res)
+}
+
+// wrap truncates n to IntBits bits, sign-extending the result.
+func (m *Machine) wrap(n int) int {
+	if m.IntBits <= 0 || m.IntBits >= 64 {
+		return n
+	}
+
+	shift := 64 - m.IntBits
+	return int(int64(n) << shift >> shift)
+}
+
+// unaryOperation applies one of the 1+, 1-, 2+, 2-, 2* and 2/ words to the
+// top of the stack.
+func (m *Machine) unaryOperation(st parser.UnaryOperationStatement) error {
+	err := m.need(symbols[lexer.Token(st)], 1)
+	if err != nil {
+		return err
+	}
+
+	op := m.Stack[len(m.Stack)-1]
+	if op.IsFloat() {
+		m.Stack[len(m.Stack)-1] = Float(unaryOperand(lexer.Token(st), op.Float()))
+		return nil
+	}
+
+	val := Int(m.wrap(unaryOperand(lexer.Token(st), op.Int())))
+	switch lexer.Token(st) {
+	case lexer.OnePlus, lexer.OneMinus, lexer.TwoPlus, lexer.TwoMinus:
+		val.owner = op.owner
+	}
+	m.Stack[len(m.Stack)-1] = val
+
+	return nil
+}
+
+func unaryOperand[T int | float64](op lexer.Token, n T) T {
+	switch op {
+	case lexer.OnePlus:
+		return n + 1
+	case lexer.OneMinus:
+		return n - 1
+	case lexer.TwoPlus:
+		return n + 2
+	case lexer.TwoMinus:
+		return n - 2
+	case lexer.TwoMultiply:
+		return n * 2
+	case lexer.TwoDivide:
+		return n / 2
+	}
+
+	return n
+}
+
+func (m *Machine) drop(st *parser.DropStatement) error {
+	err := m.need("drop", 1)
+	if err != nil {
+		return err
+	}
+
+	m.Stack = m.Stack[:len(m.Stack)-1]
+	return nil
+}
+
+func (m *Machine) dup(st *parser.DupStatement) error {
+	err := m.need("dup", 1)
+	if err != nil {
+		return err
+	}
+
+	m.Stack = append(m.Stack, m.Stack[len(m.Stack)-1])
+	return nil
+}
+
+func (m *Machine) qdup(st *parser.QDupStatement) error {
+	err := m.need("?dup", 1)
+	if err != nil {
+		return err
+	}
+
+	if top := m.Stack[len(m.Stack)-1]; !top.IsZero() {
+		m.Stack = append(m.Stack, top)
+	}
+
+	return nil
+}
+
+func (m *Machine) swap(st *parser.SwapStatement) error {
+	err := m.need("swap", 2)
+	if err != nil {
+		return err
+	}
+
+	idx1, idx2 := len(m.Stack)-2, len(m.Stack)-1
+	m.Stack[idx1], m.Stack[idx2] = m.Stack[idx2], m.Stack[idx1]
+
+	return nil
+}
+
+// rollAll rotates the whole stack by one, moving the bottom item to the top.
+func (m *Machine) rollAll(st *parser.RollAllStatement) error {
+	if len(m.Stack) < 2 {
+		return nil
+	}
+
+	bottom := m.Stack[0]
+	copy(m.Stack, m.Stack[1:])
+	m.Stack[len(m.Stack)-1] = bottom
+	return nil
+}
+
+// reverse pops n and reverses the order of the top n items of the stack.
+func (m *Machine) reverse(st *parser.ReverseStatement) error {
+	args, err := m.popInts("reverse", 1)
+	if err != nil {
+		return err
+	}
+
+	n := args[0]
+	if n < 0 {
+		return fmt.Errorf("cannot reverse %d items", n)
+	}
+
+	err = m.need("reverse", n)
+	if err != nil {
+		return err
+	}
+
+	top := m.Stack[len(m.Stack)-n:]
+	for i, j := 0, len(top)-1; i < j; i, j = i+1, j-1 {
+		top[i], top[j] = top[j], top[i]
+	}
+
+	return nil
+}
+
+// empty pushes 1 if the stack is empty and 0 otherwise.
+func (m *Machine) empty(st *parser.EmptyStatement) error {
+	if len(m.Stack) == 0 {
+		m.Stack = append(m.Stack, Int(1))
+	} else {
+		m.Stack = append(m.Stack, Int(0))
+	}
+
+	return nil
+}
+
+// third pushes a copy of the third item from the top: a b c -- a b c a.
+func (m *Machine) third(st *parser.ThirdStatement) error {
+	return m.copyItem("third", 3)
+}
+
+// fourth pushes a copy of the fourth item from the top:
+// a b c d -- a b c d a.
+func (m *Machine) fourth(st *parser.FourthStatement) error {
+	return m.copyItem("fourth", 4)
+}
+
+// copyItem pushes a copy of the nth item from the top of the stack.
+func (m *Machine) copyItem(op string, n int) error {
+	err := m.need(op, n)
+	if err != nil {
+		return err
+	}
+
+	m.Stack = append(m.Stack, m.Stack[len(m.Stack)-n])
+	return nil
+}
+
+// rdepth pushes the number of function calls being executed. Tail calls
+// reuse the call they replace, so they do not add to it.
+func (m *Machine) rdepth(st *parser.RDepthStatement) error {
+	m.Stack = append(m.Stack, Int(len(m.frames)))
+	return nil
+}
+
+func (m *Machine) twoOver(st *parser.TwoOverStatement) error {
+	err := m.need("2over", 4)
+	if err != nil {
+		return err
+	}
+
+	m.Stack = append(m.Stack, m.Stack[len(m.Stack)-4:len(m.Stack)-2]...)
+	return nil
+}
+
+func (m *Machine) twoNip(st *parser.TwoNipStatement) error {
+	err := m.need("2nip", 4)
+	if err != nil {
+		return err
+	}
+
+	m.Stack = append(m.Stack[:len(m.Stack)-4], m.Stack[len(m.Stack)-2:]...)
+	return nil
+}
+
+func (m *Machine) compare(st parser.CompareOperationStatement) error {
+	err := m.need(symbols[lexer.Token(st)], 2)
+	if err != nil {
+		return err
+	}
+
+	op1, op2 := m.Stack[len(m.Stack)-2], m.Stack[len(m.Stack)-1]
+
+	var res bool
+	if op1.IsFloat() || op2.IsFloat() {
+		res = compareOperands(lexer.Token(st), op1.Float(), op2.Float())
+	} else {
+		res = compareOperands(lexer.Token(st), op1.Int(), op2.Int())
+	}
+
+	val := 0
+	if res {
+		val = 1
+	}
+
+	m.Stack = append(m.Stack[:len(m.Stack)-2], Int(val))
+	return nil
+}
+
+// symbols maps operator tokens to how they are referred to in errors.
+var symbols = map[lexer.Token]string{
+	lexer.Minus:    "'-'",
+	lexer.Plus:     "'+'",
+	lexer.Multiply: "'*'",
+	lexer.Divide:   "'/'",
+	lexer.Modulus:  "mod",
+
+	lexer.OnePlus:     "'1+'",
+	lexer.OneMinus:    "'1-'",
+	lexer.TwoPlus:     "'2+'",
+	lexer.TwoMinus:    "'2-'",
+	lexer.TwoMultiply: "'2*'",
+	lexer.TwoDivide:   "'2/'",
+
+	lexer.EQ:  "'='",
+	lexer.NE:  "'<>'",
+	lexer.LT:  "'<'",
+	lexer.GT:  "'>'",
+	lexer.LTE: "'<='",
+	lexer.GTE: "'>='",
+}
+
+func compareOperands[T int | float64](op lexer.Token, op1, op2 T) bool {
+	switch op {
+	case lexer.EQ:
+		return op1 == op2
+	case lexer.NE:
+		return op1 != op2
+	case lexer.LT:
+		return op1 < op2
+	case lexer.GT:
+		return op1 > op2
+	case lexer.LTE:
+		return op1 <= op2
+	case lexer.GTE:
+		return op1 >= op2
+	}
+
+	return false
+}
+
+func (m *Machine) get(st *parser.GetStatement) error {
+	err := m.need("get", 1)
+	if err != nil {
+		return err
+	}
+
+	ptr, err := m.deref(m.Stack[len(m.Stack)-1])
+	if err != nil {
+		return err
+	}
+
+	m.Stack = append(m.Stack[:len(m.Stack)-1], Int(m.wrap(*ptr)))
+	return nil
+}
+
+func (m *Machine) store(st *parser.StoreStatement) error {
+	err := m.need("store", 2)
+	if err != nil {
+		return err
+	}
+
+	val := m.Stack[len(m.Stack)-2].Int()
+	ptr, err := m.deref(m.Stack[len(m.Stack)-1])
+	if err != nil {
+		return err
+	}
+	*ptr = val
+
+	m.Stack = m.Stack[:len(m.Stack)-2]
+	return nil
+}
+
+func (m *Machine) print(st *parser.PrintStatement) error {
+	err := m.need("print", 1)
+	if err != nil {
+		return err
+	}
+
+	val := m.Stack[len(m.Stack)-1]
+	m.Stack = m.Stack[:len(m.Stack)-1]
+
+	str, err := m.format(val)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprint(m.out, str, " ")
+	return err
+}
+
+// uprint prints the top of the stack as an unsigned integer of IntBits bits
+// followed by a space.
+func (m *Machine) uprint(st *parser.UPrintStatement) error {
+	err := m.need("u.", 1)
+	if err != nil {
+		return err
+	}
+
+	n := uint64(m.Stack[len(m.Stack)-1].Int())
+	m.Stack = m.Stack[:len(m.Stack)-1]
+
+	if m.IntBits > 0 && m.IntBits < 64 {
+		n &= 1<<m.IntBits - 1
+	}
+
+	_, err = fmt.Fprint(m.out, strconv.FormatUint(n, m.Base), " ")
+	return err
+}
+
+// printStack prints the depth of the stack followed by its items, bottom
+// first, without changing it.
+func (m *Machine) printStack(st *parser.PrintStackStatement) error {
+	return m.writeStack(m.out)
+}
+
+// writeStack writes the depth of the stack followed by its items to w, in
+// the format of .s.
+func (m *Machine) writeStack(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "<%d> ", len(m.Stack))
+	if err != nil {
+		return err
+	}
+
+	for _, val := range m.Stack {
+		str, err := m.format(val)
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprint(w, str, " ")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// words prints the sorted names of the defined variables, functions and
+// registered words.
+func (m *Machine) words(st *parser.WordsStatement) error {
+	var names []string
+	for name := range m.Addresses {
+		names = append(names, name)
+	}
+	for name := range m.Functions {
+		names = append(names, name)
+	}
+	for name := range m.Constants {
+		names = append(names, name)
+	}
+	for name := range m.Values {
+		names = append(names, name)
+	}
+	for name := range m.builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	_, err := fmt.Fprintln(m.out, strings.Join(names, " "))
+	return err
+}
+
+// numWords pushes the number of defined functions, constants and registered
+// words.
+func (m *Machine) numWords(st *parser.NumWordsStatement) error {
+	m.Stack = append(m.Stack, Int(len(m.Functions)+len(m.Constants)+len(m.builtins)))
+	return nil
+}
+
+// numVars pushes the number of declared global variables.
+func (m *Machine) numVars(st *parser.NumVarsStatement) error {
+	m.Stack = append(m.Stack, Int(len(m.Addresses)))
+	return nil
+}
+
+func (m *Machine) hex(st *parser.HexStatement) error {
+	m.Base = 16
+	return nil
+}
+
+func (m *Machine) decimal(st *parser.DecimalStatement) error {
+	m.Base = 10
+	return nil
+}
+
+// format formats val for printing, using Base for integers.
+func (m *Machine) format(val Value) (string, error) {
+	if val.IsFloat() {
+		return val.String(), nil
+	}
+
+	if m.Base < 2 || m.Base > 36 {
+		return "", fmt.Errorf("invalid base %d", m.Base)
+	}
+
+	return strconv.FormatInt(int64(val.Int()), m.Base), nil
+}
+
+// alias defines st.Name as another name for the function, constant or
+// registered word st.Target.
+func (m *Machine) alias(st *parser.AliasStatement) error {
+	if kind := m.definedAs(st.Name); kind != "" {
+		return &RedeclarationError{Kind: "alias", Name: st.Name, Existing: kind}
+	}
+
+	if fn, ok := m.Functions[m.key(st.Target)]; ok {
+		m.Functions[m.key(st.Name)] = fn
+		return nil
+	}
+
+	if val, ok := m.Constants[m.key(st.Target)]; ok {
+		m.Constants[m.key(st.Name)] = val
+		return nil
+	}
+
+	if fn, ok := m.builtins[m.key(st.Target)]; ok {
+		m.builtins[m.key(st.Name)] = fn
+		return nil
+	}
+
+	return &UnresolvedIdentifierError{Name: st.Target}
+}
+
+// enum defines the names in st as constants numbered from zero.
+func (m *Machine) enum(st *parser.EnumStatement) error {
+	for i, name := range st.Names {
+		if kind := m.definedAs(name); kind != "" {
+			return &RedeclarationError{Kind: "constant", Name: name, Existing: kind, Pos: st.Pos}
+		}
+
+		m.Constants[m.key(name)] = i
+	}
+
+	return nil
+}
+
+// abort pops a flag and fails with st.Message if it is nonzero.
+func (m *Machine) abort(st *parser.AbortStatement) error {
+	err := m.need("abort\"", 1)
+	if err != nil {
+		return err
+	}
+
+	flag := m.Stack[len(m.Stack)-1]
+	m.Stack = m.Stack[:len(m.Stack)-1]
+
+	if flag.IsZero() {
+		return nil
+	}
+
+	return &AbortError{Message: st.Message}
+}
+
+// value pops the initial value of the value st.Name and defines it.
+func (m *Machine) value(st *parser.ValueStatement) error {
+	if kind := m.definedAs(st.Name); kind != "" {
+		return &RedeclarationError{Kind: "value", Name: st.Name, Existing: kind, Pos: st.Pos}
+	}
+
+	args, err := m.popInts("value", 1)
+	if err != nil {
+		return err
+	}
+
+	m.Values[m.key(st.Name)] = args[0]
+	return nil
+}
+
+// to pops a number and assigns it to the value st.Name.
+func (m *Machine) to(st *parser.ToStatement) error {
+	if _, ok := m.Values[m.key(st.Name)]; !ok {
+		if kind := m.definedAs(st.Name); kind != "" {
+			return fmt.Errorf("cannot assign to %s %q, it is not a value", kind, st.Name)
+		}
+
+		return &UnresolvedIdentifierError{Name: st.Name}
+	}
+
+	args, err := m.popInts("to", 1)
+	if err != nil {
+		return err
+	}
+
+	m.Values[m.key(st.Name)] = args[0]
+	return nil
+}
+
+// defined pushes 1 if a variable, function, constant, value or registered
+// word is called st.Name, 0 otherwise.
+func (m *Machine) defined(st *parser.DefinedStatement) error {
+	_, isVar := m.lookupVariable(st.Name)
+
+	if isVar || m.definedAs(st.Name) != "" {
+		m.Stack = append(m.Stack, Int(1))
+	} else {
+		m.Stack = append(m.Stack, Int(0))
+	}
+
+	return nil
+}
+
+// tick pushes the execution token of a function, its index in m.xts.
+func (m *Machine) tick(st *parser.TickStatement) error {
+	fn, ok := m.Functions[m.key(st.Name)]
+	if !ok {
+		return &UnresolvedIdentifierError{Name: st.Name}
+	}
+
+	for xt, xfn := range m.xts {
+		if xfn == fn {
+			m.Stack = append(m.Stack, Int(xt))
+			break
+		}
+	}
+
+	return nil
+}
+
+// execute calls the function whose execution token is on top of the stack.
+func (m *Machine) execute(st *parser.ExecuteStatement) error {
+	err := m.need("execute", 1)
+	if err != nil {
+		return err
+	}
+
+	xt := m.Stack[len(m.Stack)-1].Int()
+	m.Stack = m.Stack[:len(m.Stack)-1]
+
+	fn, err := m.lookupXT(xt)
+	if err != nil {
+		return err
+	}
+
+	return m.call(fn)
+}
+
+// qexecute calls one of two functions given by execution tokens, the first
+// if the flag on top of the stack is nonzero and the second otherwise:
+// xt1 xt2 flag ?execute.
+func (m *Machine) qexecute(st *parser.QExecuteStatement) error {
+	err := m.need("?execute", 3)
+	if err != nil {
+		return err
+	}
+
+	xt1, xt2 := m.Stack[len(m.Stack)-3].Int(), m.Stack[len(m.Stack)-2].Int()
+	flag := m.Stack[len(m.Stack)-1]
+	m.Stack = m.Stack[:len(m.Stack)-3]
+
+	fn1, err := m.lookupXT(xt1)
+	if err != nil {
+		return err
+	}
+
+	fn2, err := m.lookupXT(xt2)
+	if err != nil {
+		return err
+	}
+
+	if !flag.IsZero() {
+		return m.call(fn1)
+	}
 
-	case *parser.DupStatement:
-		err := m.dup(st)
-		if err != nil {
-			return err
-		}
+	return m.call(fn2)
+}
 
-	case *parser.SwapStatement:
-		err := m.swap(st)
-		if err != nil {
-			return err
-		}
+func (m *Machine) lookupXT(xt int) (*parser.FunctionStatement, error) {
+	if xt < 0 || xt >= len(m.xts) {
+		return nil, fmt.Errorf("invalid execution token %d", xt)
+	}
 
-	case parser.CompareOperationStatement:
-		err := m.compare(st)
-		if err != nil {
-			return err
-		}
+	return m.xts[xt], nil
+}
 
-	case *parser.GetStatement:
-		err := m.get(st)
-		if err != nil {
-			return err
-		}
+// mark records the depth of the stack, for a later arity.
+func (m *Machine) mark(st *parser.MarkStatement) error {
+	m.marks = append(m.marks, len(m.Stack))
+	return nil
+}
 
-	case *parser.StoreStatement:
-		err := m.store(st)
-		if err != nil {
-			return err
-		}
+// arity pushes the number of items added to the stack since the last mark,
+// negative if items were removed, and forgets the mark.
+func (m *Machine) arity(st *parser.ArityStatement) error {
+	if len(m.marks) == 0 {
+		return ErrArityWithoutMark
+	}
 
-	case *parser.IfStatement:
-		err := m._if(st)
-		if err != nil {
-			return err
-		}
+	mark := m.marks[len(m.marks)-1]
+	m.marks = m.marks[:len(m.marks)-1]
 
-	case *parser.WhileStatement:
-		err := m.while(st)
-		if err != nil {
-			return err
-		}
+	m.Stack = append(m.Stack, Int(len(m.Stack)-mark))
+	return nil
+}
 
-	case *parser.QuitStatement:
-		return nil
+// bool replaces the top of the stack with 1 if it is nonzero and 0
+// otherwise, the flags pushed by comparisons. if and while already treat
+// any nonzero value as true, so normalizing only matters when flags are
+// used in arithmetic or compared with each other.
+func (m *Machine) bool(st *parser.BoolStatement) error {
+	return m.truth("bool", 1)
+}
 
-	default:
+// not replaces the top of the stack with 1 if it is zero and 0 otherwise.
+func (m *Machine) not(st *parser.NotStatement) error {
+	err := m.need("not", 1)
+	if err != nil {
+		return err
+	}
+
+	if m.Stack[len(m.Stack)-1].IsZero() {
+		m.Stack[len(m.Stack)-1] = Int(1)
+	} else {
+		m.Stack[len(m.Stack)-1] = Int(0)
 	}
 
 	return nil
 }
 
-func (m *Machine) declareVariable(st *parser.DeclarationStatement) error {
-	v := &Variable{
-		Name: st.Name,
-		Size: st.Cells,
-		Data: make([]int, st.Cells),
+// flag is like bool but uses -1 for true, as Forth does.
+func (m *Machine) flag(st *parser.FlagStatement) error {
+	return m.truth("flag", -1)
+}
+
+// truth replaces the top of the stack with t if it is nonzero and 0
+// otherwise.
+func (m *Machine) truth(op string, t int) error {
+	err := m.need(op, 1)
+	if err != nil {
+		return err
 	}
 
-	if _, ok := m.Addresses[v.Name]; ok {
-		return errors.New("cannot redeclare variable \"" + v.Name + "\"")
+	if m.Stack[len(m.Stack)-1].IsZero() {
+		m.Stack[len(m.Stack)-1] = Int(0)
+	} else {
+		m.Stack[len(m.Stack)-1] = Int(t)
 	}
 
-	if _, ok := m.Functions[v.Name]; ok {
-		return errors.New("cannot declare variable \"" + v.Name + "\", function already exists with that name")
+	return nil
+}
+
+// sqrt replaces the top of the stack with its square root, rounded down for
+// integers.
+func (m *Machine) sqrt(st *parser.SqrtStatement) error {
+	err := m.need("sqrt", 1)
+	if err != nil {
+		return err
 	}
 
-	var addr int
-	if len(m.Variables) > 0 {
-		lastVar := m.Variables[len(m.Variables)-1]
-		addr = m.Addresses[lastVar.Name] + lastVar.Size
+	val := m.Stack[len(m.Stack)-1]
+	if val.Float() < 0 {
+		return ErrNegativeSquareRoot
+	}
+
+	if val.IsFloat() {
+		m.Stack[len(m.Stack)-1] = Float(math.Sqrt(val.Float()))
+	} else {
+		m.Stack[len(m.Stack)-1] = Int(m.wrap(isqrt(val.Int())))
 	}
 
-	m.Addresses[v.Name] = addr
-	m.Variables = append(m.Variables, v)
 	return nil
 }
 
-func (m *Machine) function(st *parser.FunctionStatement) error {
-	if _, ok := m.Addresses[st.Name]; ok {
-		return errors.New("cannot define function \"" + st.Name + "\", variable with this name already exists")
+// isqrt returns the floor of the square root of n, which must not be
+// negative, using Newton's method on integers.
+func isqrt(n int) int {
+	if n < 2 {
+		return n
 	}
 
-	if _, ok := m.Functions[st.Name]; ok {
-		return errors.New("cannot redefine function \"" + st.Name + "\"")
+	x := n
+	y := n/2 + n%2
+	for y < x {
+		x = y
+		y = (x + n/x) / 2
 	}
 
-	m.Functions[st.Name] = st
-	return nil
+	return x
 }
 
-func (m *Machine) pushNumber(st *parser.PushNumberStatement) error {
-	m.Stack = append(m.Stack, st.Number)
+// gcd replaces the top two items with their greatest common divisor, which
+// is never negative. The gcd of 0 and 0 is 0.
+func (m *Machine) gcd(st *parser.GcdStatement) error {
+	args, err := m.peekInts("gcd", 2)
+	if err != nil {
+		return err
+	}
+
+	g, err := gcd(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if g != m.wrap(g) {
+		return ErrOverflow
+	}
+
+	m.Stack = append(m.Stack[:len(m.Stack)-2], Int(g))
 	return nil
 }
 
-func (m *Machine) indentifierCall(st *parser.IdentifierCallStatement) error {
-	if addr, ok := m.Addresses[st.Identifier]; ok {
-		m.Stack = append(m.Stack, addr)
-		return nil
+// lcm replaces the top two items with their least common multiple, which is
+// never negative. The lcm of 0 and anything is 0.
+func (m *Machine) lcm(st *parser.LcmStatement) error {
+	args, err := m.peekInts("lcm", 2)
+	if err != nil {
+		return err
 	}
 
-	if fn, ok := m.Functions[st.Identifier]; ok {
-		for _, st := range fn.Body {
-			err := m.exec(st)
-			if err != nil {
-				return err
-			}
-		}
+	a, b := args[0], args[1]
+	if a == 0 || b == 0 {
+		m.Stack = append(m.Stack[:len(m.Stack)-2], Int(0))
 		return nil
 	}
 
-	return errors.New("cannot resolve identifier \"" + st.Identifier + "\"")
-}
-
-func (m *Machine) resolveVariable(addr int) (*Variable, int, error) {
-	var caddr int
+	g, err := gcd(a, b)
+	if err != nil {
+		return err
+	}
 
-	var v *Variable
-	for _, v = range m.Variables {
-		if caddr <= addr && addr < caddr+v.Size {
-			break
-		}
-		caddr += v.Size
+	q := a / g
+	l := q * b
+	if l/q != b || l == math.MinInt {
+		return ErrOverflow
 	}
 
-	if v == nil || addr < caddr || addr >= caddr+v.Size {
-		return nil, 0, errors.New("could not resolve address")
+	if l < 0 {
+		l = -l
+	}
+	if l != m.wrap(l) {
+		return ErrOverflow
 	}
 
-	return v, addr - caddr, nil
+	m.Stack = append(m.Stack[:len(m.Stack)-2], Int(l))
+	return nil
 }
 
-func (m *Machine) resolveAddr(addr int) (*int, error) {
-	v, idx, err := m.resolveVariable(addr)
+// modPow replaces base, exp and mod with base to the power of exp, modulo
+// mod: base exp mod modpow. The result is never negative.
+func (m *Machine) modPow(st *parser.ModPowStatement) error {
+	args, err := m.peekInts("modpow", 3)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return &v.Data[idx], nil
-}
-
-func (m *Machine) mathOperation(st parser.MathOperationStatement) error {
-	if len(m.Stack) < 2 {
-		return errors.New("cannot perform math operation, stack does not have 2 items")
+	base, exp, mod := args[0], args[1], args[2]
+	if mod <= 0 {
+		return fmt.Errorf("invalid modulus %d", mod)
+	}
+	if exp < 0 {
+		return fmt.Errorf("invalid exponent %d", exp)
 	}
 
-	op1, op2 := m.Stack[len(m.Stack)-2], m.Stack[len(m.Stack)-1]
+	b := uint64(base % mod)
+	if base%mod < 0 {
+		b = uint64(base%mod + mod)
+	}
 
-	var res int
-	switch lexer.Token(st) {
-	case lexer.Minus:
-		res = op1 - op2
-	case lexer.Plus:
-		res = op1 + op2
-	case lexer.Multiply:
-		res = op1 * op2
-	case lexer.Divide:
-		res = op1 / op2
-	case lexer.Modulus:
-		res = op1 % op2
+	res := uint64(1) % uint64(mod)
+	for e := uint64(exp); e > 0; e >>= 1 {
+		if e&1 == 1 {
+			res = mulMod(res, b, uint64(mod))
+		}
+		b = mulMod(b, b, uint64(mod))
 	}
 
-	m.Stack = append(m.Stack[:len(m.Stack)-2], res)
+	m.Stack = append(m.Stack[:len(m.Stack)-3], Int(m.wrap(int(res))))
 	return nil
 }
 
-func (m *Machine) drop(st *parser.DropStatement) error {
-	if len(m.Stack) < 1 {
-		return errors.New("cannot drop, stack empty")
+// mulMod returns a*b mod m without overflowing, for a and b less than m.
+func mulMod(a, b, m uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	_, rem := bits.Div64(hi, lo, m)
+	return rem
+}
+
+// factorial replaces n with n!, computed iteratively.
+func (m *Machine) factorial(st *parser.FactorialStatement) error {
+	err := m.need("factorial", 1)
+	if err != nil {
+		return err
 	}
 
-	m.Stack = m.Stack[:len(m.Stack)-1]
+	n := m.Stack[len(m.Stack)-1].Int()
+	if n < 0 {
+		return fmt.Errorf("factorial of negative number %d", n)
+	}
+
+	res := 1
+	// once wrapped around to 0 the result cannot change
+	for i := 2; i <= n && res != 0; i++ {
+		next := res * i
+		if m.CheckOverflow && (next/i != res || next != m.wrap(next)) {
+			return ErrOverflow
+		}
+		res = next
+	}
+
+	m.Stack[len(m.Stack)-1] = Int(m.wrap(res))
 	return nil
 }
 
-func (m *Machine) dup(st *parser.DupStatement) error {
-	if len(m.Stack) < 1 {
-		return errors.New("cannot dup, stack empty")
+func gcd(a, b int) (int, error) {
+	for b != 0 {
+		a, b = b, a%b
 	}
 
-	m.Stack = append(m.Stack, m.Stack[len(m.Stack)-1])
-	return nil
+	if a == math.MinInt {
+		return 0, ErrOverflow
+	}
+	if a < 0 {
+		a = -a
+	}
+
+	return a, nil
 }
 
-func (m *Machine) swap(st *parser.SwapStatement) error {
-	if len(m.Stack) < 2 {
-		return errors.New("cannot perform swap operation, stack does not have 2 items")
+// random replaces n with a pseudo-random integer in [0, n).
+func (m *Machine) random(st *parser.RandomStatement) error {
+	err := m.need("random", 1)
+	if err != nil {
+		return err
 	}
 
-	idx1, idx2 := len(m.Stack)-2, len(m.Stack)-1
-	m.Stack[idx1], m.Stack[idx2] = m.Stack[idx2], m.Stack[idx1]
+	n := m.Stack[len(m.Stack)-1].Int()
+	if n <= 0 {
+		return fmt.Errorf("invalid random bound %d", n)
+	}
 
+	m.Stack[len(m.Stack)-1] = Int(m.rand.Intn(n))
 	return nil
 }
 
-func (m *Machine) compare(st parser.CompareOperationStatement) error {
-	if len(m.Stack) < 2 {
-		return errors.New("cannot perform compare operation, stack does not have 2 items")
+// within pushes 1 if low <= val < high and 0 otherwise: val low high within.
+func (m *Machine) within(st *parser.WithinStatement) error {
+	args, err := m.popInts("within", 3)
+	if err != nil {
+		return err
 	}
 
-	op1, op2 := m.Stack[len(m.Stack)-2], m.Stack[len(m.Stack)-1]
+	val, low, high := args[0], args[1], args[2]
+	if low <= val && val < high {
+		m.Stack = append(m.Stack, Int(1))
+	} else {
+		m.Stack = append(m.Stack, Int(0))
+	}
 
-	var res bool
-	switch lexer.Token(st) {
-	case lexer.EQ:
-		res = op1 == op2
-	case lexer.LT:
-		res = op1 < op2
-	case lexer.GT:
-		res = op1 > op2
-	case lexer.LTE:
-		res = op1 <= op2
-	case lexer.GTE:
-		res = op1 >= op2
+	return nil
+}
+
+// divMod pushes both the remainder and the quotient of a division:
+// a b -- rem quot.
+func (m *Machine) divMod(st *parser.DivModStatement) error {
+	args, err := m.peekInts("/mod", 2)
+	if err != nil {
+		return err
 	}
 
-	val := 0
-	if res {
-		val = 1
+	if args[1] == 0 {
+		return ErrDivisionByZero
 	}
 
-	m.Stack = append(m.Stack[:len(m.Stack)-2], val)
+	a, b := args[0], args[1]
+	m.Stack = append(m.Stack[:len(m.Stack)-2], Int(m.wrap(a%b)), Int(m.wrap(a/b)))
 	return nil
 }
 
-func (m *Machine) get(st *parser.GetStatement) error {
-	if len(m.Stack) < 1 {
-		return errors.New("cannot perform if, stack empty")
+// mulDiv multiplies two numbers and divides the product by a third, keeping
+// the full product so it cannot overflow: a b c -- a*b/c.
+func (m *Machine) mulDiv(st *parser.MulDivStatement) error {
+	args, err := m.peekInts("*/", 3)
+	if err != nil {
+		return err
 	}
 
-	addr := m.Stack[len(m.Stack)-1]
-
-	ptr, err := m.resolveAddr(addr)
+	_, quot, err := m.scale(args[0], args[1], args[2])
 	if err != nil {
 		return err
 	}
 
-	m.Stack = append(m.Stack[:len(m.Stack)-1], *ptr)
+	m.Stack = append(m.Stack[:len(m.Stack)-3], Int(quot))
 	return nil
 }
 
-func (m *Machine) store(st *parser.StoreStatement) error {
-	if len(m.Stack) < 2 {
-		return errors.New("cannot perform store operation, stack does not have 2 items")
+// mulDivMod is like */ but also pushes the remainder: a b c -- rem quot.
+func (m *Machine) mulDivMod(st *parser.MulDivModStatement) error {
+	args, err := m.peekInts("*/mod", 3)
+	if err != nil {
+		return err
 	}
 
-	val, addr := m.Stack[len(m.Stack)-2], m.Stack[len(m.Stack)-1]
-	ptr, err := m.resolveAddr(addr)
+	rem, quot, err := m.scale(args[0], args[1], args[2])
 	if err != nil {
 		return err
 	}
-	*ptr = val
 
-	m.Stack = m.Stack[:len(m.Stack)-2]
+	m.Stack = append(m.Stack[:len(m.Stack)-3], Int(m.wrap(rem)), Int(quot))
 	return nil
 }
 
+// scale divides a*b by c, computing the product with as many bits as needed.
+// Quotients that do not fit in an integer fail with ErrOverflow.
+func (m *Machine) scale(a, b, c int) (rem, quot int, err error) {
+	if c == 0 {
+		return 0, 0, ErrDivisionByZero
+	}
+
+	prod := new(big.Int).Mul(big.NewInt(int64(a)), big.NewInt(int64(b)))
+	q, r := new(big.Int).QuoRem(prod, big.NewInt(int64(c)), new(big.Int))
+	if !q.IsInt64() || m.wrap(int(q.Int64())) != int(q.Int64()) {
+		return 0, 0, ErrOverflow
+	}
+
+	return int(r.Int64()), int(q.Int64()), nil
+}
+
 func (m *Machine) _if(st *parser.IfStatement) error {
-	if len(m.Stack) < 1 {
-		return errors.New("cannot perform if, stack empty")
+	err := m.need("if", 1)
+	if err != nil {
+		return err
 	}
 
 	val := m.Stack[len(m.Stack)-1]
 	m.Stack = m.Stack[:len(m.Stack)-1]
 
-	if val != 0 {
+	if !val.IsZero() {
 		for _, st := range st.Body {
-			err := m.exec(st)
+			err = m.exec(st)
 			if err != nil {
-				return err
+				return withContext(err, "in if")
 			}
 		}
 	} else if len(st.ElseBody) > 0 {
 		for _, st := range st.ElseBody {
-			err := m.exec(st)
+			err = m.exec(st)
 			if err != nil {
-				return err
+				return withContext(err, "in else")
 			}
 		}
 	}
@@ -372,22 +2299,25 @@ func (m *Machine) _if(st *parser.IfStatement) error {
 
 func (m *Machine) while(st *parser.WhileStatement) error {
 	for {
-
-		if len(m.Stack) < 1 {
-			return errors.New("cannot perform while, stack empty")
+		err := m.need("while", 1)
+		if err != nil {
+			return err
 		}
 
 		val := m.Stack[len(m.Stack)-1]
 		m.Stack = m.Stack[:len(m.Stack)-1]
 
-		if val == 0 {
+		if val.IsZero() {
 			break
 		}
 
 		for _, st := range st.Body {
-			err := m.exec(st)
+			err = m.exec(st)
+			if errors.Is(err, errLeave) {
+				return nil
+			}
 			if err != nil {
-				return err
+				return withContext(err, "in while loop")
 			}
 		}
 	}
@@ -395,23 +2325,127 @@ func (m *Machine) while(st *parser.WhileStatement) error {
 	return nil
 }
 
+// time runs the body of st and prints the time it took.
+func (m *Machine) time(st *parser.TimeStatement) error {
+	start := time.Now()
+
+	err := m.execBody(st.Body)
+	if err != nil {
+		return withContext(err, "in time")
+	}
+
+	_, err = fmt.Fprintln(m.out, time.Since(start))
+	return err
+}
+
+// _case runs the body of the clause whose value equals the top of the stack,
+// or the default body if none does. Floating-point selectors match clauses
+// with the same numeric value, so 2.0 selects 2.
+func (m *Machine) _case(st *parser.CaseStatement) error {
+	err := m.need("case", 1)
+	if err != nil {
+		return err
+	}
+
+	val := m.Stack[len(m.Stack)-1]
+	m.Stack = m.Stack[:len(m.Stack)-1]
+
+	for _, clause := range st.Cases {
+		match := val.Int() == clause.Value
+		if val.IsFloat() {
+			match = val.Float() == float64(clause.Value)
+		}
+
+		if match {
+			return m.execBody(clause.Body)
+		}
+	}
+
+	return m.execBody(st.Default)
+}
+
+// pop pops the top n items of the stack, returning them bottom first.
+// Nothing is popped if the stack has less than n items.
+func (m *Machine) pop(op string, n int) ([]Value, error) {
+	err := m.need(op, n)
+	if err != nil {
+		return nil, err
+	}
+
+	vals := make([]Value, n)
+	copy(vals, m.Stack[len(m.Stack)-n:])
+
+	m.Stack = m.Stack[:len(m.Stack)-n]
+	return vals, nil
+}
+
+// peekInts returns the top n items of the stack as integers, bottom first,
+// without popping them, so that operations which can fail leave the stack
+// as it was.
+func (m *Machine) peekInts(op string, n int) ([]int, error) {
+	err := m.need(op, n)
+	if err != nil {
+		return nil, err
+	}
+
+	ints := make([]int, n)
+	for i, val := range m.Stack[len(m.Stack)-n:] {
+		ints[i] = val.Int()
+	}
+
+	return ints, nil
+}
+
+// popInts pops the top n items of the stack as integers, returning them
+// bottom first. Nothing is popped if the stack has less than n items.
+func (m *Machine) popInts(op string, n int) ([]int, error) {
+	vals, err := m.pop(op, n)
+	if err != nil {
+		return nil, err
+	}
+
+	ints := make([]int, n)
+	for i, val := range vals {
+		ints[i] = val.Int()
+	}
+
+	return ints, nil
+}
+
+// execBody executes the statements in body in order.
+func (m *Machine) execBody(body []parser.Statement) error {
+	for _, st := range body {
+		err := m.exec(st)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (m *Machine) debugComments(st *parser.Comment) error {
-	parts := strings.Split(st.Body, " ")
+	if !m.EnableDebugComments {
+		return nil
+	}
+
+	parts := strings.Fields(st.Body)
 	if len(parts) < 2 || parts[0] != "debug" {
 		return nil
 	}
 
 	switch parts[1] {
 	case "stack":
-		fmt.Fprint(os.Stderr, m.Stack, " ", strings.Join(parts[2:], " "), "\n")
+		_, err := fmt.Fprint(m.out, m.Stack, " ", strings.Join(parts[2:], " "), "\n")
+		return err
 	case "var":
 		if len(parts) < 3 {
 			return nil
 		}
 
-		addr, ok := m.Addresses[parts[2]]
+		addr, ok := m.lookupVariable(parts[2])
 		if !ok {
-			return errors.New("invalid variable " + parts[2])
+			return &UnresolvedIdentifierError{Name: parts[2]}
 		}
 
 		v, idx, err := m.resolveVariable(addr)
@@ -419,7 +2453,8 @@ func (m *Machine) debugComments(st *parser.Comment) error {
 			return err
 		}
 
-		fmt.Fprint(os.Stderr, v.Name, " ", v.Data[idx], " ", strings.Join(parts[3:], " "), "\n")
+		_, err = fmt.Fprint(m.out, v.Name, " ", v.Data[idx], " ", strings.Join(parts[3:], " "), "\n")
+		return err
 	}
 
 	return nil
@@ -0,0 +1,1005 @@
+package runner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/noonien/techon/parser"
+)
+
+func TestProfile(t *testing.T) {
+	m := NewMachine()
+	if m.Profile() != nil {
+		t.Error("Profile is not nil before profiling is enabled")
+	}
+
+	m.EnableProfiling()
+	err := run(t, m, ": f dup ; 1 f f drop drop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile := m.Profile()
+	want := map[string]int{
+		"FunctionStatement":       1,
+		"PushNumberStatement":     1,
+		"IdentifierCallStatement": 2,
+		"DupStatement":            2,
+		"DropStatement":           2,
+	}
+
+	for name, count := range want {
+		if profile[name] != count {
+			t.Errorf("%s: got %d, want %d", name, profile[name], count)
+		}
+	}
+
+	profile["DupStatement"] = 100
+	if m.Profile()["DupStatement"] != 2 {
+		t.Error("modifying the returned profile changed the machine's")
+	}
+}
+
+func TestTwoOverTwoNip(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"1 2 3 4 2over", "[1 2 3 4 1 2]"},
+		{"1 2 3 4 2nip", "[3 4]"},
+		{"5 1 2 3 4 2nip", "[5 3 4]"},
+	})
+
+	var underflow *StackUnderflowError
+	for _, src := range []string{"1 2 3 2over", "1 2 3 2nip"} {
+		err := run(t, NewMachine(), src)
+		if !errors.As(err, &underflow) || underflow.Need != 4 {
+			t.Errorf("%q: got %v, want an underflow needing 4 items", src, err)
+		}
+	}
+}
+
+func TestBase(t *testing.T) {
+	got := outputOf(t, "255 . hex 255 . -16 . 1.5 . decimal 255 .")
+	want := "255 ff -10 1.5 255 "
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestLocalVariables(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"variable x 5 x ! : f variable x 7 x ! x @ ; f x @ f", "[7 5 7]"},
+		{": f variable t 2 cells t 1+ ! t 1+ @ ; 3 f 4 f", "[3 4]"},
+		{": count variable n dup n ! if n @ 1- count n @ then ; 2 count", "[1 2]"},
+	})
+
+	m := NewMachine()
+	err := run(t, m, "variable g : f variable l 1 l ! ; f f")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Variables) != 1 {
+		t.Errorf("got %d variables after the calls, want 1", len(m.Variables))
+	}
+
+	err = run(t, NewMachine(), ": f variable l variable l ; f")
+	var redecl *RedeclarationError
+	if !errors.As(err, &redecl) {
+		t.Errorf("got %v, want a RedeclarationError", err)
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	testStacks(t, []stackTest{
+		{": down dup if 1- down then ; 1000000 down", "[0]"},
+		{"variable acc : sum dup if dup acc @ + acc ! 1- sum then ; 100 sum drop acc @", "[5050]"},
+	})
+
+	m := NewMachine()
+	err := run(t, m, ": f dup if 1- f 1+ else f then ;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.tailCalls) != 1 {
+		t.Errorf("got %d tail calls, want only the one in the else branch", len(m.tailCalls))
+	}
+}
+
+func TestNotEqual(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"1 2 <>", "[1]"},
+		{"2 2 <>", "[0]"},
+		{"1.0 1 <>", "[0]"},
+		{"1.5 1 <>", "[1]"},
+	})
+}
+
+func TestQDup(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"0 ?dup", "[0]"},
+		{"3 ?dup", "[3 3]"},
+		{"0.0 ?dup", "[0.0]"},
+		{"-1.5 ?dup", "[-1.5 -1.5]"},
+	})
+
+	var underflow *StackUnderflowError
+	err := run(t, NewMachine(), "?dup")
+	if !errors.As(err, &underflow) {
+		t.Errorf("got %v, want a StackUnderflowError", err)
+	}
+}
+
+func TestUnaryOperations(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"5 1+", "[6]"},
+		{"5 1-", "[4]"},
+		{"5 2+", "[7]"},
+		{"5 2-", "[3]"},
+		{"5 2*", "[10]"},
+		{"5 2/", "[2]"},
+		{"-5 2/", "[-2]"},
+		{"1.5 1-", "[0.5]"},
+	})
+}
+
+func TestLeaveAndQuit(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"3 dup while 1- dup 1 = if leave then dup repeat", "[1]"},
+		{": f 1 while leave repeat 5 ; f", "[5]"},
+		{"1 2 quit 3", "[1 2]"},
+		{": f 1 quit 2 ; f 3", "[1]"},
+		{": f 1 while 2 quit repeat ; f 3", "[2]"},
+	})
+
+	for _, src := range []string{"leave", ": f leave ; 1 while f repeat"} {
+		err := run(t, NewMachine(), src)
+		if !errors.Is(err, ErrLeaveOutsideLoop) {
+			t.Errorf("%q: got %v, want ErrLeaveOutsideLoop", src, err)
+		}
+	}
+}
+
+func TestExecutionTokens(t *testing.T) {
+	testStacks(t, []stackTest{
+		{": sq dup * ; 3 ' sq execute", "[9]"},
+		{": a 1 ; : b 2 ; ' a ' b", "[0 1]"},
+		{": a 1 ; : b 2 ; 5 ' a ' b swap drop execute", "[5 2]"},
+	})
+
+	for _, src := range []string{"99 execute", "-1 execute", "' nope"} {
+		if err := run(t, NewMachine(), src); err == nil {
+			t.Errorf("%q: got no error", src)
+		}
+	}
+}
+
+func TestExit(t *testing.T) {
+	testStacks(t, []stackTest{
+		{": f 1 exit 2 ; f 3", "[1 3]"},
+		{": f dup 0 < if drop 0 exit then 10 * ; -5 f 5 f", "[0 50]"},
+		{": f 0 1 while 1+ dup 3 = if exit then 1 repeat 99 ; f", "[3]"},
+		{": g 1 exit 2 ; : f g 3 ; f", "[1 3]"},
+		{": f 5 case 5 of 1 exit endof endcase 2 ; f", "[1]"},
+	})
+
+	for _, src := range []string{"exit", "1 if exit then", "1 while exit repeat"} {
+		err := run(t, NewMachine(), src)
+		if !errors.Is(err, ErrExitOutsideFunction) {
+			t.Errorf("%q: got %v, want ErrExitOutsideFunction", src, err)
+		}
+	}
+}
+
+func TestQExecute(t *testing.T) {
+	const decls = ": yes 1 ; : no 0 ; ' yes ' no "
+	testStacks(t, []stackTest{
+		{decls + "1 ?execute", "[1]"},
+		{decls + "0 ?execute", "[0]"},
+		{decls + "-5 ?execute", "[1]"},
+		{decls + "0.0 ?execute", "[0]"},
+	})
+
+	for _, src := range []string{
+		": yes 1 ; ' yes 1 ?execute",
+		": yes 1 ; ' yes 99 1 ?execute",
+	} {
+		if err := run(t, NewMachine(), src); err == nil {
+			t.Errorf("%q: got no error", src)
+		}
+	}
+}
+
+func TestCase(t *testing.T) {
+	const cases = " case 1 of 10 endof 2 of 20 endof 99 endcase"
+	testStacks(t, []stackTest{
+		{"1" + cases, "[10]"},
+		{"2" + cases, "[20]"},
+		{"3" + cases, "[99]"},
+		{"2.0" + cases, "[20]"},
+		{"2.5" + cases, "[99]"},
+		{"-0.0 case 0 of 1 endof endcase", "[1]"},
+		{"5 case 1 of 10 endof endcase", "[]"},
+	})
+}
+
+func TestForwardReferences(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"f : f 1 ;", "[1]"},
+		{": a b 1+ ; : b 2 ; a", "[3]"},
+		{"x @ variable x", "[0]"},
+		{"4 even : even 2 mod 0 = ; 3 even", "[1 0]"},
+	})
+}
+
+func TestMainFunction(t *testing.T) {
+	testStacks(t, []stackTest{
+		{": main 1 ;", "[1]"},
+		{"(entry point) : main 1 ;", "[1]"},
+		{": main 1 ; main", "[1]"},
+		{": main 1 ; 5", "[5]"},
+		{"1 quit : main 2 ;", "[1]"},
+		{": Main 1 ; 5", "[5]"},
+	})
+}
+
+func TestPrintStack(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"1 2 3 .s", "<3> 1 2 3 "},
+		{".s", "<0> "},
+		{"1.5 hex 255 .s", "<2> 1.5 ff "},
+	}
+
+	for _, tt := range tests {
+		if got := outputOf(t, tt.src); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.src, got, tt.want)
+		}
+	}
+
+	if got := stackOf(t, "1 2 .s"); got != "[1 2]" {
+		t.Errorf(".s changed the stack to %s", got)
+	}
+}
+
+func TestMaxMinInt(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"maxint", "[9223372036854775807]"},
+		{"minint", "[-9223372036854775808]"},
+		{"maxint 1 +", "[-9223372036854775808]"},
+		{"minint 1 -", "[9223372036854775807]"},
+	})
+
+	m := NewMachine()
+	m.CheckOverflow = true
+	err := run(t, m, "maxint 1 +")
+	if !errors.Is(err, ErrOverflow) {
+		t.Errorf("got %v, want ErrOverflow", err)
+	}
+}
+
+func TestArity(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"mark 1 2 3 arity", "[1 2 3 3]"},
+		{"mark 1 mark 2 3 arity arity", "[1 2 3 2 4]"},
+		{"1 2 mark drop arity", "[1 -1]"},
+		{": two 1 2 ; mark two arity", "[1 2 2]"},
+	})
+
+	err := run(t, NewMachine(), "arity")
+	if !errors.Is(err, ErrArityWithoutMark) {
+		t.Errorf("got %v, want ErrArityWithoutMark", err)
+	}
+}
+
+func TestBoolAndFlag(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"5 bool 0 bool -3 bool 0.5 bool", "[1 0 1 1]"},
+		{"5 flag 0 flag", "[-1 0]"},
+		{"2 3 < flag", "[-1]"},
+		{"-1 bool if 7 then", "[7]"},
+	})
+}
+
+func TestDefined(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"variable x defined? x", "[1]"},
+		{": f 1 ; defined? f", "[1]"},
+		{"enum a b\ndefined? b", "[1]"},
+		{"defined? nope", "[0]"},
+		{"defined? later : later ;", "[1]"},
+	})
+}
+
+func TestSqrt(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"0 sqrt 1 sqrt 15 sqrt 16 sqrt", "[0 1 3 4]"},
+		{"maxint sqrt", "[3037000499]"},
+		{"2.25 sqrt", "[1.5]"},
+	})
+
+	for _, src := range []string{"-1 sqrt", "-0.5 sqrt"} {
+		err := run(t, NewMachine(), src)
+		if !errors.Is(err, ErrNegativeSquareRoot) {
+			t.Errorf("%q: got %v, want ErrNegativeSquareRoot", src, err)
+		}
+	}
+}
+
+func TestGcdLcm(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"12 18 gcd", "[6]"},
+		{"-12 18 gcd", "[6]"},
+		{"0 0 gcd", "[0]"},
+		{"7 0 gcd", "[7]"},
+		{"4 6 lcm", "[12]"},
+		{"-4 6 lcm", "[12]"},
+		{"0 5 lcm", "[0]"},
+	})
+
+	// failures leave the operands on the stack
+	for _, src := range []string{"minint 0 gcd", "maxint maxint 1- lcm"} {
+		m := NewMachine()
+		err := run(t, m, src)
+		if !errors.Is(err, ErrOverflow) {
+			t.Errorf("%q: got %v, want ErrOverflow", src, err)
+		}
+
+		if len(m.Stack) != 2 {
+			t.Errorf("%q: got stack %v, want the operands", src, m.Stack)
+		}
+	}
+}
+
+func TestRollAll(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"1 2 3 roll-all", "[2 3 1]"},
+		{"1 2 3 roll-all roll-all roll-all", "[1 2 3]"},
+		{"1 roll-all", "[1]"},
+		{"roll-all", "[]"},
+	})
+}
+
+func TestEmpty(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"empty?", "[1]"},
+		{"1 empty?", "[1 0]"},
+		{"1 drop empty?", "[1]"},
+	})
+}
+
+func TestIntBits(t *testing.T) {
+	tests := []struct {
+		bits int
+		src  string
+		want string
+	}{
+		{32, "maxint minint", "[2147483647 -2147483648]"},
+		{32, "maxint 1 +", "[-2147483648]"},
+		{32, "3000000000", "[-1294967296]"},
+		{32, "2147483647 1+", "[-2147483648]"},
+		{32, "65536 65536 *", "[0]"},
+		{32, "-2147483648 -1 /", "[-2147483648]"},
+		{32, "20 factorial", "[-2102132736]"},
+		{32, "12 18 gcd 4 6 lcm", "[6 12]"},
+		{32, "variable x 3000000000000.0 x ! x @", "[2112827392]"},
+		{16, "maxint minint", "[32767 -32768]"},
+		{16, "30000 sqrt", "[173]"},
+		{8, "200", "[-56]"},
+		{64, "maxint", "[9223372036854775807]"},
+	}
+
+	for _, tt := range tests {
+		m := NewMachine()
+		m.IntBits = tt.bits
+
+		err := run(t, m, tt.src)
+		if err != nil {
+			t.Errorf("%q with %d bits: %v", tt.src, tt.bits, err)
+			continue
+		}
+
+		if got := fmt.Sprint(m.Stack); got != tt.want {
+			t.Errorf("%q with %d bits: got %s, want %s", tt.src, tt.bits, got, tt.want)
+		}
+	}
+
+	for _, src := range []string{"-2147483648 0 gcd", "65536 65537 lcm"} {
+		m := NewMachine()
+		m.IntBits = 32
+
+		err := run(t, m, src)
+		if !errors.Is(err, ErrOverflow) {
+			t.Errorf("%q with 32 bits: got %v, want ErrOverflow", src, err)
+		}
+	}
+}
+
+func TestOverflowFlag(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"maxint 2 * overflow?", "[-2 1]"},
+		{"3 4 * overflow?", "[12 0]"},
+		{"maxint 1 + overflow? overflow?", "[-9223372036854775808 1 0]"},
+		{"maxint 1 + 1 1 + overflow?", "[-9223372036854775808 2 0]"},
+		{"minint 1 - overflow?", "[9223372036854775807 1]"},
+		{"minint -1 / overflow?", "[-9223372036854775808 1]"},
+	})
+
+	m := NewMachine()
+	m.IntBits = 32
+	if err := run(t, m, "65536 65536 * overflow? 32768 65535 * overflow?"); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(m.Stack); got != "[0 1 2147450880 0]" {
+		t.Errorf("with 32 bits: got %s, want [0 1 2147450880 0]", got)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	m := NewMachine()
+	err := m.Register("triple", func(m *Machine) error {
+		args, err := m.popInts("triple", 1)
+		if err != nil {
+			return err
+		}
+
+		m.Stack = append(m.Stack, Int(args[0]*3))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = run(t, m, "5 triple : nine 3 triple ; nine")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := fmt.Sprint(m.Stack); got != "[15 9]" {
+		t.Errorf("got %s, want [15 9]", got)
+	}
+
+	var redecl *RedeclarationError
+	if err := m.Register("triple", nil); !errors.As(err, &redecl) {
+		t.Errorf("registering triple twice: got %v, want a RedeclarationError", err)
+	}
+	if err := m.Register("nine", nil); !errors.As(err, &redecl) {
+		t.Errorf("registering over a function: got %v, want a RedeclarationError", err)
+	}
+	if err := run(t, m, ": triple 3 * ;"); !errors.As(err, &redecl) {
+		t.Errorf("declaring a registered word: got %v, want a RedeclarationError", err)
+	}
+}
+
+func TestModPow(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"4 13 497 modpow", "[445]"},
+		{"2 10 1000 modpow", "[24]"},
+		{"-2 3 5 modpow", "[2]"},
+		{"5 0 1 modpow", "[0]"},
+		{"3 maxint maxint modpow", "[" + fmt.Sprint(modPowSlow(3, 1<<63-1, 1<<63-1)) + "]"},
+	})
+
+	// failures leave the operands on the stack
+	for _, src := range []string{"1 1 0 modpow", "1 1 -5 modpow", "1 -1 5 modpow"} {
+		m := NewMachine()
+		if err := run(t, m, src); err == nil {
+			t.Errorf("%q: got no error", src)
+		}
+
+		if len(m.Stack) != 3 {
+			t.Errorf("%q: got stack %v, want the operands", src, m.Stack)
+		}
+	}
+}
+
+// modPowSlow computes base**exp modulo mod with math/big.
+func modPowSlow(base, exp, mod int64) int64 {
+	return new(big.Int).Exp(big.NewInt(base), big.NewInt(exp), big.NewInt(mod)).Int64()
+}
+
+func TestRandom(t *testing.T) {
+	a, b := NewMachine(), NewMachine()
+	for _, m := range []*Machine{a, b} {
+		err := run(t, m, "10 random 10 random 1000000 random 1 random")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if fmt.Sprint(a.Stack) != fmt.Sprint(b.Stack) {
+		t.Errorf("machines are not deterministic: %v and %v", a.Stack, b.Stack)
+	}
+
+	for i, val := range a.Stack[:2] {
+		if n := val.Int(); n < 0 || n >= 10 {
+			t.Errorf("item %d: %d is out of range", i, n)
+		}
+	}
+	if a.Stack[3].Int() != 0 {
+		t.Errorf("1 random returned %v", a.Stack[3])
+	}
+
+	a.Seed(42)
+	b.Seed(42)
+	for _, m := range []*Machine{a, b} {
+		m.Stack = nil
+		if err := run(t, m, "1000000 random"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a.Stack[0] != b.Stack[0] {
+		t.Error("machines seeded alike returned different numbers")
+	}
+
+	for _, src := range []string{"0 random", "-1 random"} {
+		if err := run(t, NewMachine(), src); err == nil {
+			t.Errorf("%q: got no error", src)
+		}
+	}
+}
+
+func TestTime(t *testing.T) {
+	var out bytes.Buffer
+	m := NewMachine()
+	m.SetOutput(&out)
+
+	err := run(t, m, "time 1 2 + endtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := fmt.Sprint(m.Stack); got != "[3]" {
+		t.Errorf("got %s, want [3]", got)
+	}
+
+	_, err = time.ParseDuration(strings.TrimSpace(out.String()))
+	if err != nil {
+		t.Errorf("printed %q, want a duration: %v", out.String(), err)
+	}
+
+	err = run(t, NewMachine(), "time drop endtime")
+	if err == nil || !strings.HasPrefix(err.Error(), "in time: ") {
+		t.Errorf("got %v, want an error in time", err)
+	}
+}
+
+func TestThirdFourth(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"1 2 3 third", "[1 2 3 1]"},
+		{"1 2 3 4 fourth", "[1 2 3 4 1]"},
+		{"0 1 2 3 4 fourth", "[0 1 2 3 4 1]"},
+	})
+
+	var underflow *StackUnderflowError
+	for _, src := range []string{"1 2 third", "1 2 3 fourth"} {
+		err := run(t, NewMachine(), src)
+		if !errors.As(err, &underflow) {
+			t.Errorf("%q: got %v, want a StackUnderflowError", src, err)
+		}
+	}
+}
+
+func TestNot(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"0 not", "[1]"},
+		{"5 not", "[0]"},
+		{"0.0 not", "[1]"},
+		{"0 not if 7 then", "[7]"},
+		{"1 2 < not if 7 else 8 then", "[8]"},
+	})
+
+	var underflow *StackUnderflowError
+	if err := run(t, NewMachine(), "not"); !errors.As(err, &underflow) {
+		t.Errorf("got %v, want a StackUnderflowError", err)
+	}
+}
+
+func TestWords(t *testing.T) {
+	got := outputOf(t, ": beta ; : alpha ; variable gamma enum DELTA\nwords")
+	if want := "DELTA alpha beta gamma\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if got := outputOf(t, "words"); got != "\n" {
+		t.Errorf("got %q with nothing defined", got)
+	}
+}
+
+func TestStrictIdentifiers(t *testing.T) {
+	var unresolved *UnresolvedIdentifierError
+	if err := run(t, NewMachine(), "1 nope 2"); !errors.As(err, &unresolved) {
+		t.Errorf("got %v, want an UnresolvedIdentifierError by default", err)
+	}
+
+	var out bytes.Buffer
+	m := NewMachine()
+	m.StrictIdentifiers = false
+	m.SetOutput(&out)
+
+	err := run(t, m, "1 nope 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := fmt.Sprint(m.Stack); got != "[1 2]" {
+		t.Errorf("got %s, want [1 2]", got)
+	}
+
+	if want := "warning: cannot resolve identifier \"nope\"\n"; out.String() != want {
+		t.Errorf("printed %q, want %q", out.String(), want)
+	}
+}
+
+func TestFactorial(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"0 factorial 1 factorial 5 factorial", "[1 1 120]"},
+		{"20 factorial", "[2432902008176640000]"},
+		{"21 factorial", "[-4249290049419214848]"},
+		{"100 factorial", "[0]"},
+	})
+
+	if err := run(t, NewMachine(), "-1 factorial"); err == nil {
+		t.Error("the factorial of -1 did not fail")
+	}
+}
+
+func TestCheckOverflow(t *testing.T) {
+	for _, src := range []string{
+		"maxint 1 +",
+		"minint 1 -",
+		"maxint 2 *",
+		"minint -1 /",
+		"21 factorial",
+	} {
+		m := NewMachine()
+		m.CheckOverflow = true
+
+		err := run(t, m, src)
+		if !errors.Is(err, ErrOverflow) {
+			t.Errorf("%q: got %v, want ErrOverflow", src, err)
+		}
+	}
+
+	m := NewMachine()
+	m.CheckOverflow = true
+	if err := run(t, m, "maxint 1 - 20 factorial"); err != nil {
+		t.Errorf("got %v without overflowing", err)
+	}
+}
+
+func TestAlias(t *testing.T) {
+	testStacks(t, []stackTest{
+		{": sq dup * ;\nalias square sq\n3 square", "[9]"},
+		{"alias square sq\n: sq dup * ;\n4 square", "[16]"},
+		{"enum a b\nalias c b\nc", "[1]"},
+	})
+
+	for _, src := range []string{
+		"alias x nope",
+		": f ;\nalias f f",
+	} {
+		if err := run(t, NewMachine(), src); err == nil {
+			t.Errorf("%q did not fail", src)
+		}
+	}
+}
+
+func TestUPrint(t *testing.T) {
+	tests := []struct {
+		bits int
+		src  string
+		want string
+	}{
+		{64, "-1 u.", "18446744073709551615 "},
+		{32, "-1 u.", "4294967295 "},
+		{16, "-2 u.", "65534 "},
+		{64, "42 u.", "42 "},
+		{64, "hex -1 u.", "ffffffffffffffff "},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		m := NewMachine()
+		m.IntBits = tt.bits
+		m.SetOutput(&out)
+
+		if err := run(t, m, tt.src); err != nil {
+			t.Errorf("%q with %d bits: %v", tt.src, tt.bits, err)
+			continue
+		}
+
+		if out.String() != tt.want {
+			t.Errorf("%q with %d bits: printed %q, want %q", tt.src, tt.bits, out.String(), tt.want)
+		}
+	}
+}
+
+func TestRDepth(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"rdepth", "[0]"},
+		{": g rdepth ; : h g ; g h", "[1 2]"},
+		{": f dup if 1 - rdepth swap f 0 drop then ; 3 f", "[1 2 3 0]"},
+		// tail calls reuse the caller's frame
+		{": f dup if 1 - rdepth swap f then ; 3 f", "[1 1 1 0]"},
+	})
+}
+
+func TestCounts(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"#words #vars", "[0 0]"},
+		{"variable a variable b 3 cells enum x y\n: f ; : g ; #words #vars", "[4 2]"},
+		{": f ; alias h f #words", "[2]"},
+	})
+}
+
+func TestDebugComments(t *testing.T) {
+	const src = "1 2 ( debug stack after push ) (debug stack) ( debugging )"
+
+	var out bytes.Buffer
+	m := NewMachine()
+	m.SetOutput(&out)
+	if err := run(t, m, src); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "[1 2] after push\n[1 2] \n"
+	if out.String() != want {
+		t.Errorf("printed %q, want %q", out.String(), want)
+	}
+
+	out.Reset()
+	m = NewMachine()
+	m.SetOutput(&out)
+	m.EnableDebugComments = false
+	if err := run(t, m, src+"( debug var nope )"); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.Len() > 0 {
+		t.Errorf("printed %q with debug comments disabled", out.String())
+	}
+}
+
+func TestDebugCommentsOutput(t *testing.T) {
+	var out bytes.Buffer
+	m := NewMachine()
+	m.SetOutput(&out)
+
+	err := run(t, m, "variable x 3 cells 7 x 1+ ! 4 ( debug stack ) ( debug var x at start )")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "[4] \nx 0 at start\n"
+	if out.String() != want {
+		t.Errorf("printed %q, want %q", out.String(), want)
+	}
+
+	var unresolved *UnresolvedIdentifierError
+	err = run(t, NewMachine(), "( debug var nope )")
+	if !errors.As(err, &unresolved) {
+		t.Errorf("got %v, want an UnresolvedIdentifierError", err)
+	}
+}
+
+func TestEnum(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"enum RED GREEN BLUE\nRED GREEN BLUE", "[0 1 2]"},
+		{": f BLUE ;\nenum RED GREEN BLUE\nf", "[2]"},
+		{"enum A\nenum B\nA B", "[0 0]"},
+	})
+
+	var redecl *RedeclarationError
+	err := run(t, NewMachine(), "variable A\nenum A")
+	if !errors.As(err, &redecl) {
+		t.Errorf("got %v, want a RedeclarationError", err)
+	}
+
+	for _, src := range []string{": f enum A B\n; f f", "1 if enum A\nthen", "enum\n"} {
+		_, err := parser.NewParser(strings.NewReader(src)).Parse()
+		if err == nil {
+			t.Errorf("%q: parsed without error", src)
+		}
+	}
+}
+
+func TestGetch(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"AB", "[65 66 -1]"},
+		{"é\n", "[233 10 -1]"},
+		{"", "[-1 -1 -1]"},
+	}
+
+	for _, tt := range tests {
+		m := NewMachine()
+		m.SetInput(strings.NewReader(tt.input))
+
+		if err := run(t, m, "getch getch getch"); err != nil {
+			t.Fatalf("%q: %v", tt.input, err)
+		}
+		if got := fmt.Sprint(m.Stack); got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.input, got, tt.want)
+		}
+	}
+
+	if got := stackOf(t, "getch"); got != "[-1]" {
+		t.Errorf("without input: got %s, want [-1]", got)
+	}
+}
+
+func TestReturnStackPairs(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"1 2 2>r 3 2r>", "[3 1 2]"},
+		{"1 2 2>r 2r@ 2r>", "[1 2 1 2]"},
+		{"1 2 3 4 2>r 2>r 2r> 2r>", "[1 2 3 4]"},
+		{"1 >r 2 3 2>r 2r> r>", "[2 3 1]"},
+	})
+
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"1 2>r", "cannot perform 2>r: stack has 1 of 2 required items"},
+		{"2r>", "cannot perform 2r>: return stack has 0 of 2 required items"},
+		{"1 >r 2r@", "cannot perform 2r@: return stack has 1 of 2 required items"},
+	}
+
+	for _, tt := range tests {
+		err := run(t, NewMachine(), tt.src)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%q: got %v, want %s", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestReturns(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"returns", "[0]"},
+		{"1 >r 2 >r returns", "[2]"},
+		{"1 >r 2 >r r> drop returns r> drop returns", "[1 0]"},
+		{"1 2 2>r returns 0 >r returns", "[2 3]"},
+	})
+}
+
+func TestValue(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"5 value x x 10 to x x", "[5 10]"},
+		{"5 value x : bump x 1+ to x ; bump bump x", "[7]"},
+		{"1 value a 2 value b a b", "[1 2]"},
+	})
+
+	for _, src := range []string{
+		"5 to x",
+		"value x",
+		"5 value x 6 value x",
+		"variable x 5 value x",
+	} {
+		if err := run(t, NewMachine(), src); err == nil {
+			t.Errorf("%q: got no error", src)
+		}
+	}
+
+	for _, src := range []string{": f 5 value x ; f f", "1 if 5 value x then"} {
+		_, err := parser.NewParser(strings.NewReader(src)).Parse()
+		if err == nil {
+			t.Errorf("%q: parsed without error", src)
+		}
+	}
+}
+
+func TestWithin(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"5 1 10 within", "[1]"},
+		{"10 1 10 within", "[0]"},
+		{"1 1 10 within", "[1]"},
+		{"0 1 10 within", "[0]"},
+		{"-3 -5 0 within -5 -5 0 within", "[1 1]"},
+		{"0 -5 0 within -6 -5 0 within", "[0 0]"},
+		{"1.5 1 2 within", "[1]"},
+	})
+
+	err := run(t, NewMachine(), "1 2 within")
+	want := "cannot perform within: stack has 2 of 3 required items"
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v, want %s", err, want)
+	}
+}
+
+func TestDivMod(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"17 5 /mod", "[2 3]"},
+		{"-17 5 /mod", "[-2 -3]"},
+		{"10 3 2 */", "[15]"},
+		{"10 3 4 */mod", "[2 7]"},
+		{"maxint 2 4 */", "[4611686018427387903]"},
+		{"maxint maxint maxint */", "[9223372036854775807]"},
+	})
+
+	// failures leave the operands on the stack
+	for _, tt := range []struct {
+		src  string
+		want error
+	}{
+		{"1 0 /mod", ErrDivisionByZero},
+		{"1 2 0 */", ErrDivisionByZero},
+		{"1 2 0 */mod", ErrDivisionByZero},
+		{"maxint 4 2 */", ErrOverflow},
+		{"maxint 4 2 */mod", ErrOverflow},
+	} {
+		m := NewMachine()
+		err := run(t, m, tt.src)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.src, err, tt.want)
+		}
+
+		if n := len(strings.Fields(tt.src)) - 1; len(m.Stack) != n {
+			t.Errorf("%q: got stack %v, want the operands", tt.src, m.Stack)
+		}
+	}
+}
+
+func TestReverse(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"1 2 3 4 3 reverse", "[1 4 3 2]"},
+		{"1 2 3 4 4 reverse", "[4 3 2 1]"},
+		{"1 2 0 reverse", "[1 2]"},
+		{"1 2 1 reverse", "[1 2]"},
+	})
+
+	var underflow *StackUnderflowError
+	if err := run(t, NewMachine(), "1 2 3 reverse"); !errors.As(err, &underflow) {
+		t.Errorf("got %v, want a StackUnderflowError", err)
+	}
+
+	for _, src := range []string{"1 2 -1 reverse", "reverse"} {
+		if err := run(t, NewMachine(), src); err == nil {
+			t.Errorf("%q: got no error", src)
+		}
+	}
+}
+
+func TestCaseInsensitiveIdentifiers(t *testing.T) {
+	tests := []stackTest{
+		{"variable Foo 5 FOO ! foo @", "[5]"},
+		{": Sq dup * ; 3 SQ", "[9]"},
+		{"5 value V v 7 to V v", "[5 7]"},
+		{"enum Red Green\nGREEN", "[1]"},
+		{": sq dup * ; alias Square SQ 4 square", "[16]"},
+		{": Main 1 ;", "[1]"},
+	}
+
+	for _, tt := range tests {
+		m := NewMachine()
+		m.CaseInsensitiveIdentifiers = true
+
+		if err := run(t, m, tt.src); err != nil {
+			t.Errorf("%q: %v", tt.src, err)
+			continue
+		}
+		if got := fmt.Sprint(m.Stack); got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.src, got, tt.want)
+		}
+	}
+
+	m := NewMachine()
+	m.CaseInsensitiveIdentifiers = true
+	var redecl *RedeclarationError
+	if err := run(t, m, "variable x : X ;"); !errors.As(err, &redecl) {
+		t.Errorf("got %v, want a RedeclarationError", err)
+	}
+
+	testStacks(t, []stackTest{
+		{"variable x variable X 1 x ! 2 X ! x @ X @", "[1 2]"},
+		{": Main 1 ;", "[]"},
+	})
+}
@@ -0,0 +1,109 @@
+package runner
+
+import "github.com/noonien/techon/parser"
+
+// Validate checks that every identifier used in prog resolves to a variable,
+// function, constant or registered word, either already defined on m or
+// declared anywhere in prog, so unresolved names are reported before anything
+// runs. Functions may be used before the point where they are defined.
+func (m *Machine) Validate(prog parser.Program) error {
+	v := &validator{
+		vars:     make(map[string]bool),
+		funcs:    make(map[string]bool),
+		builtins: make(map[string]bool),
+		key:      m.key,
+	}
+
+	for name := range m.Addresses {
+		v.vars[name] = true
+	}
+	for name := range m.Functions {
+		v.funcs[name] = true
+	}
+	for name := range m.Constants {
+		v.vars[name] = true
+	}
+	for name := range m.Values {
+		v.vars[name] = true
+	}
+	for name := range m.builtins {
+		v.builtins[name] = true
+	}
+
+	for _, st := range prog {
+		switch st := st.(type) {
+		case *parser.DeclarationStatement:
+			v.vars[v.key(st.Name)] = true
+		case *parser.FunctionStatement:
+			v.funcs[v.key(st.Name)] = true
+		case *parser.AliasStatement:
+			v.funcs[v.key(st.Name)] = true
+		case *parser.EnumStatement:
+			for _, name := range st.Names {
+				v.vars[v.key(name)] = true
+			}
+		case *parser.ValueStatement:
+			v.vars[v.key(st.Name)] = true
+		}
+	}
+
+	return v.validate(prog, nil)
+}
+
+type validator struct {
+	vars     map[string]bool
+	funcs    map[string]bool
+	builtins map[string]bool
+
+	// key returns the key a name is looked up by.
+	key func(name string) string
+}
+
+// validate checks the identifiers used in body, which may also refer to the
+// given local variables.
+func (v *validator) validate(body []parser.Statement, locals map[string]bool) error {
+	var err error
+	parser.Walk(body, func(st parser.Statement) bool {
+		if err != nil {
+			return false
+		}
+
+		switch st := st.(type) {
+		case *parser.FunctionStatement:
+			fnLocals := make(map[string]bool)
+			for _, st := range st.Body {
+				if decl, ok := st.(*parser.DeclarationStatement); ok {
+					fnLocals[v.key(decl.Name)] = true
+				}
+			}
+
+			err = v.validate(st.Body, fnLocals)
+			return false
+
+		case *parser.IdentifierCallStatement:
+			name := v.key(st.Identifier)
+			if !locals[name] && !v.vars[name] && !v.funcs[name] && !v.builtins[name] {
+				err = &UnresolvedIdentifierError{Name: st.Identifier}
+			}
+
+		case *parser.TickStatement:
+			if !v.funcs[v.key(st.Name)] {
+				err = &UnresolvedIdentifierError{Name: st.Name}
+			}
+
+		case *parser.SeeStatement:
+			if !v.funcs[v.key(st.Name)] {
+				err = &UnresolvedIdentifierError{Name: st.Name}
+			}
+
+		case *parser.ToStatement:
+			if !v.vars[v.key(st.Name)] {
+				err = &UnresolvedIdentifierError{Name: st.Name}
+			}
+		}
+
+		return true
+	})
+
+	return err
+}
@@ -0,0 +1,45 @@
+package runner
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		src   string
+		unres string
+	}{
+		{"variable x x @ .", ""},
+		{"f : f 1 ;", ""},
+		{": f variable l l @ ; f", ""},
+		{"1 if missing then", "missing"},
+		{": f l ; : g variable l ;", "l"},
+		{"' nope", "nope"},
+	}
+
+	for _, tt := range tests {
+		err := NewMachine().Validate(parse(t, tt.src))
+
+		var unresolved *UnresolvedIdentifierError
+		switch {
+		case tt.unres == "" && err != nil:
+			t.Errorf("%q: got %v, want no error", tt.src, err)
+		case tt.unres != "" && (!errors.As(err, &unresolved) || unresolved.Name != tt.unres):
+			t.Errorf("%q: got %v, want %s to be unresolved", tt.src, err, tt.unres)
+		}
+	}
+}
+
+func TestValidateMachine(t *testing.T) {
+	m := NewMachine()
+	err := run(t, m, "variable x : f 1 ;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Validate(parse(t, "x @ f"))
+	if err != nil {
+		t.Errorf("names defined on the machine are unresolved: %v", err)
+	}
+}
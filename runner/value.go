@@ -0,0 +1,86 @@
+package runner
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Value is an item on the stack, either an integer or a floating-point
+// number.
+type Value struct {
+	i       int
+	f       float64
+	isFloat bool
+
+	// owner is the variable an address was taken from when StrictMemory
+	// is set, so that accesses through it can be bounds-checked.
+	owner *Variable
+}
+
+// Int returns an integer Value.
+func Int(n int) Value {
+	return Value{i: n}
+}
+
+// Float returns a floating-point Value.
+func Float(f float64) Value {
+	return Value{f: f, isFloat: true}
+}
+
+// IsFloat reports whether v holds a floating-point number.
+func (v Value) IsFloat() bool {
+	return v.isFloat
+}
+
+// Int returns v as an integer, truncating floating-point numbers toward
+// zero.
+func (v Value) Int() int {
+	if v.isFloat {
+		return int(v.f)
+	}
+
+	return v.i
+}
+
+// Float returns v as a floating-point number.
+func (v Value) Float() float64 {
+	if v.isFloat {
+		return v.f
+	}
+
+	return float64(v.i)
+}
+
+// IsZero reports whether v is zero, which conditions treat as false.
+func (v Value) IsZero() bool {
+	if v.isFloat {
+		return v.f == 0
+	}
+
+	return v.i == 0
+}
+
+// String formats v in base 10. Floating-point numbers always contain a
+// decimal point or exponent, so they can be told apart from integers.
+func (v Value) String() string {
+	if !v.isFloat {
+		return strconv.Itoa(v.i)
+	}
+
+	s := strconv.FormatFloat(v.f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+
+	return s
+}
+
+func (v Value) MarshalJSON() ([]byte, error) {
+	if v.isFloat && (math.IsInf(v.f, 0) || math.IsNaN(v.f)) {
+		return nil, errors.New("cannot encode " + v.String() + " as JSON")
+	}
+
+	return []byte(v.String()), nil
+}
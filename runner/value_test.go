@@ -0,0 +1,68 @@
+package runner
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestValueString(t *testing.T) {
+	tests := []struct {
+		val  Value
+		want string
+	}{
+		{Int(-3), "-3"},
+		{Float(2), "2.0"},
+		{Float(3.5), "3.5"},
+		{Float(1e21), "1e+21"},
+		{Float(math.Inf(1)), "+Inf"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.val.String(); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestValueConversions(t *testing.T) {
+	if got := Float(-2.7).Int(); got != -2 {
+		t.Errorf("Float(-2.7).Int() = %d, want -2", got)
+	}
+
+	if got := Int(3).Float(); got != 3 {
+		t.Errorf("Int(3).Float() = %v, want 3", got)
+	}
+
+	if !Float(0).IsZero() || Float(0.5).IsZero() {
+		t.Error("IsZero is wrong for floats")
+	}
+}
+
+func TestValueJSON(t *testing.T) {
+	b, err := json.Marshal([]Value{Int(1), Float(2), Float(0.25)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "[1,2.0,0.25]" {
+		t.Errorf("got %s, want [1,2.0,0.25]", b)
+	}
+
+	_, err = json.Marshal(Float(math.NaN()))
+	if err == nil {
+		t.Error("encoding NaN did not fail")
+	}
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	testStacks(t, []stackTest{
+		{"1.5 2 +", "[3.5]"},
+		{"7 2 /", "[3]"},
+		{"7.0 2 /", "[3.5]"},
+		{"2.0 2.0 *", "[4.0]"},
+		{"-2.5", "[-2.5]"},
+		{"5.5 2 mod", "[1.5]"},
+		{"0.5 1+", "[1.5]"},
+	})
+}
@@ -5,19 +5,11 @@ import (
 	"log"
 	"os"
 
-	"github.com/noonien/techon/parser"
 	"github.com/noonien/techon/runner"
 )
 
 func main() {
-	p := parser.NewParser(os.Stdin)
-	prog, err := p.Parse()
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	m := runner.NewMachine()
-	err = m.Execute(prog)
+	m, err := runner.Run(os.Stdin)
 	if err != nil {
 		log.Fatal(err)
 	}